@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/bundle"
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+// bundleCommand runs `totalos bundle keygen|create|install`, which
+// installs servers without internet access on either side.
+func bundleCommand(arguments []string) {
+	if len(arguments) == 0 {
+		log.Fatal("usage: totalos bundle keygen|create|install [flags]")
+	}
+	switch arguments[0] {
+	case "keygen":
+		bundleKeygen(arguments[1:])
+	case "create":
+		bundleCreate(arguments[1:])
+	case "install":
+		bundleInstall(arguments[1:])
+	default:
+		log.Fatalf("unknown bundle command %q, want keygen, create or install", arguments[0])
+	}
+}
+
+func bundleKeygen(arguments []string) {
+	fs := flag.NewFlagSet("bundle keygen", flag.ExitOnError)
+	key := fs.String("key", "bundle.key", "path the private key is written to")
+	pubkey := fs.String("pubkey", "bundle.pub", "path the public key is written to")
+	fs.Parse(arguments)
+
+	if err := bundle.WriteKeyPair(*key, *pubkey); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func bundleCreate(arguments []string) {
+	fs := flag.NewFlagSet("bundle create", flag.ExitOnError)
+	out := fs.String("out", "totalos-bundle.tar", "path the bundle is written to")
+	key := fs.String("key", "", "path to the private key signing the bundle")
+	var arches, versions, configs stringsFlag
+	fs.Var(&arches, "arch", "machine hardware name (x86_64 or aarch64) to bundle the image of (repeatable, default x86_64)")
+	fs.Var(&versions, "version", "Talos release (like v1.11.3) to bundle the images of (repeatable, default latest)")
+	fs.Var(&configs, "config", "machine configuration to bundle, as name=path (optional, repeatable)")
+	imageCache := fs.String("image-cache", "", "URL of a totalos serve-images instance to download images through (optional)")
+	fs.Parse(arguments)
+
+	if *key == "" {
+		fmt.Println("Error: --key flag is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if len(arches) == 0 {
+		arches = stringsFlag{"x86_64"}
+	}
+	if len(versions) == 0 {
+		versions = stringsFlag{""}
+	}
+	var releases []bundle.Release
+	for _, arch := range arches {
+		for _, version := range versions {
+			releases = append(releases, bundle.Release{Arch: arch, Version: version})
+		}
+	}
+	configPaths := make(map[string]string)
+	for _, c := range configs {
+		name, path, ok := strings.Cut(c, "=")
+		if !ok || name == "" || path == "" {
+			log.Fatalf("--config %q is not name=path", c)
+		}
+		configPaths[name] = path
+	}
+	priv, err := bundle.ReadPrivateKey(*key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	manifest, err := bundle.Create(context.Background(), f, priv, releases, &bundle.Args{
+		Preference: &image.Preference{CacheEndpoint: *imageCache},
+		Configs:    configPaths,
+	})
+	if err != nil {
+		os.Remove(*out)
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	for _, img := range manifest.Images {
+		log.Printf("bundled %s %s (%d bytes, sha256 %s)", img.Arch, img.Version, img.Size, img.SHA256)
+	}
+}
+
+func bundleInstall(arguments []string) {
+	fs := flag.NewFlagSet("bundle install", flag.ExitOnError)
+	bundlePath := fs.String("bundle", "", "path to the bundle")
+	pubkey := fs.String("pubkey", "", "path to the public key verifying the bundle")
+	bundleVersion := fs.String("bundle-version", "", "Talos release to install when the bundle holds several (optional)")
+	configsDir := fs.String("configs-dir", "", "directory to extract the verified machine configurations of the bundle to (optional)")
+	args := NewCallArgs(fs, arguments)
+
+	if *bundlePath == "" || *pubkey == "" {
+		fmt.Println("Error: --bundle and --pubkey flags are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if args.Image != "" || len(args.ImageMirrors) > 0 || args.ImageCache != "" || args.SecureBootImage != "" {
+		fmt.Println("Error: the image comes from the bundle, drop --image, --image-mirror, --image-cache and --secureboot-image")
+		fs.Usage()
+		os.Exit(1)
+	}
+	args.Bundle = *bundlePath
+	args.BundlePubKey = *pubkey
+	args.BundleVersion = *bundleVersion
+	if *configsDir != "" {
+		if err := extractBundleConfigs(args, *configsDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	install(args)
+}
+
+// extractBundleConfigs writes the machine configurations of the bundle
+// to dir, to be applied with talosctl once the server runs Talos.
+func extractBundleConfigs(args *CallArgs, dir string) error {
+	b, err := openBundle(args)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	for _, cfg := range b.Manifest.Configs {
+		rc, err := b.Open(cfg.Path)
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(dir, filepath.Base(cfg.Path))
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			rc.Close()
+			return err
+		}
+		_, err = io.Copy(f, rc)
+		rc.Close()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(name)
+			return err
+		}
+	}
+	return nil
+}
+
+func openBundle(args *CallArgs) (*bundle.Bundle, error) {
+	pub, err := bundle.ReadPublicKey(args.BundlePubKey)
+	if err != nil {
+		return nil, err
+	}
+	return bundle.Open(args.Bundle, pub)
+}
+
+// bundleSource streams the image of a bundle, its SHA-256 is verified
+// while reading.
+type bundleSource struct {
+	*pushedImage
+	bundle  *bundle.Bundle
+	image   *bundle.Image
+	configs []string
+}
+
+// openBundleSource opens the bundle image for the machine hardware name
+// and detects its format from the head of the file.
+func openBundleSource(args *CallArgs, machineHardwareName string) (*bundleSource, error) {
+	b, err := openBundle(args)
+	if err != nil {
+		return nil, err
+	}
+	img, err := b.Image(machineHardwareName, args.BundleVersion)
+	if err != nil {
+		return nil, err
+	}
+	pushed, err := openPushedImage(func() (io.ReadCloser, error) { return b.Open(img.Path) }, img.URL, img.Size)
+	if err != nil {
+		return nil, err
+	}
+	src := &bundleSource{pushedImage: pushed, bundle: b, image: img}
+	for _, cfg := range b.Manifest.Configs {
+		src.configs = append(src.configs, cfg.Name)
+	}
+	return src, nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import "strings"
+
+// stringsFlag is a flag.Value collecting every occurrence of a repeatable flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -4,19 +4,29 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/fabiant7t/totalos/pkg/boot"
 	"github.com/fabiant7t/totalos/pkg/disk"
+	"github.com/fabiant7t/totalos/pkg/event"
+	"github.com/fabiant7t/totalos/pkg/extension"
 	"github.com/fabiant7t/totalos/pkg/image"
 	"github.com/fabiant7t/totalos/pkg/installation"
 	"github.com/fabiant7t/totalos/pkg/kernel"
+	"github.com/fabiant7t/totalos/pkg/meta"
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
 	"github.com/fabiant7t/totalos/pkg/remotecommand/command"
 	"github.com/fabiant7t/totalos/pkg/server"
 	"golang.org/x/crypto/ssh"
@@ -32,30 +42,108 @@ type CallArgs struct {
 	Password                             string
 	KeyPath                              string
 	Image                                string
+	ImageMirrors                         []string
+	ImageHeaders                         []string
+	ImageSHA256                          string
+	ImageCache                           string
+	DockerConfig                         string
+	Overlay                              string
+	SecureBootImage                      string
+	RescueCache                          string
 	Webhook                              string
 	Config                               string
 	SetStaticInitialNetworkConfiguration bool
+	MetaNetwork                          bool
+	DNS                                  []string
+	NTP                                  []string
+	PrivateDNS                           bool
+	Verify                               bool
+	Events                               string
 	Reboot                               bool
+	ForceRewrite                         bool
+	Prefetch                             bool
+	ExtensionsSchematic                  bool
+	KernelArgs                           []string
+	RemoveKernelArgs                     []string
+	SideroLinkAPI                        string
+	SerialConsole                        string
+	Bundle                               string
+	BundlePubKey                         string
+	BundleVersion                        string
 }
 
-func NewCallArgs() *CallArgs {
-	ip := flag.String("ip", "", "IP of the server")
-	port := flag.Uint("port", 22, "SSH port of the server")
-	user := flag.String("user", "root", "name of the user")
-	password := flag.String("password", "", "password of the user (optional)")
-	keyPath := flag.String("key", "", "path to the private key (optional)")
-	image := flag.String("image", "", "URL to raw.xz or raw.zst image (optional)")
-	webhook := flag.String(
+// EditsKernelArgs tells whether the kernel command line is to be changed.
+func (a *CallArgs) EditsKernelArgs() bool {
+	return len(a.KernelArgs) > 0 || len(a.RemoveKernelArgs) > 0 || a.Config != "" || a.SetStaticInitialNetworkConfiguration || a.SideroLinkAPI != ""
+}
+
+// SerialConsoleOption returns the serial console of --serial-console,
+// like ttyS1,115200n8: the one given or the first one detected on the
+// machine. It is empty for none, or if the console is set otherwise.
+func (a *CallArgs) SerialConsoleOption(mach *server.Machine) string {
+	switch {
+	case a.SerialConsole == "none" || setsConsole(a.KernelArgs, a.RemoveKernelArgs):
+		return ""
+	case a.SerialConsole != "auto":
+		return a.SerialConsole
+	case len(mach.SerialConsoles) > 0:
+		return mach.SerialConsoles[0].Option()
+	}
+	return ""
+}
+
+// setsConsole tells whether the kernel arguments set or removed change
+// the console.
+func setsConsole(kernelArgs, removeKernelArgs []string) bool {
+	return slices.Contains(removeKernelArgs, "console") ||
+		slices.ContainsFunc(kernelArgs, func(arg string) bool { return kernel.Key(arg) == "console" })
+}
+
+// NewCallArgs defines the installation flags on the flag set and parses
+// the arguments. Subcommands define their own flags on fs beforehand.
+func NewCallArgs(fs *flag.FlagSet, arguments []string) *CallArgs {
+	ip := fs.String("ip", "", "IP of the server")
+	port := fs.Uint("port", 22, "SSH port of the server")
+	user := fs.String("user", "root", "name of the user")
+	password := fs.String("password", "", "password of the user (optional)")
+	keyPath := fs.String("key", "", "path to the private key (optional)")
+	imageURL := fs.String("image", "", "URL to raw image, plain or compressed with xz, zstd, gzip, bzip2 or lz4, or ISO: http(s)://, s3://bucket/key, file:///path or oci://registry/repository:tag (optional)")
+	var imageMirrors stringsFlag
+	fs.Var(&imageMirrors, "image-mirror", "URL of a mirror serving the same image, the fastest one is used (optional, repeatable)")
+	var imageHeaders stringsFlag
+	fs.Var(&imageHeaders, "image-header", "HTTP header sent with the download of an http(s) image, like \"Authorization: Bearer <token>\" (optional, repeatable)")
+	imageSHA256 := fs.String("image-sha256", "", "expected SHA-256 of the image download (optional)")
+	rescueCache := fs.String("rescue-cache", "", "directory on the rescue system to keep the downloaded image in for later runs (optional)")
+	imageCache := fs.String("image-cache", "", "URL of a totalos serve-images instance to download images through (optional)")
+	overlay := fs.String("overlay", "", "board overlay of an arm64 single-board computer, like rpi_generic (optional, detected from the device tree, none disables)")
+	secureBootImage := fs.String("secureboot-image", "", "signed image installed instead of --image on machines with Secure Boot enforced or in setup mode, like metal-amd64-secureboot.raw.xz of the Image Factory (optional)")
+	dockerConfig := fs.String("docker-config", "", "docker config.json with registry credentials for oci:// images (optional, default ~/.docker/config.json)")
+	webhook := fs.String(
 		"webhook",
 		"",
 		"Endpoint that should receive the report through HTTP POST (optional)",
 	)
-	config := flag.String("config", "", "URL at which the machine configuration data may be found (optional)")
-	versionFlag := flag.Bool("version", false, "prints the version")
-	setStaticInitialNetworkConfigurationFlag := flag.Bool("static", false, "set kernel parameter for static initial network configuration")
-	rebootFlag := flag.Bool("reboot", false, "reboot the server")
+	config := fs.String("config", "", "URL at which the machine configuration data may be found (optional)")
+	versionFlag := fs.Bool("version", false, "prints the version")
+	setStaticInitialNetworkConfigurationFlag := fs.Bool("static", false, "set kernel parameter for static initial network configuration")
+	metaNetworkFlag := fs.Bool("meta-network", false, "write the initial network configuration (addresses, routes, DNS, bonds and VLANs) to the META partition of Talos, alternative to --static")
+	var dnsServers, ntpServers stringsFlag
+	fs.Var(&dnsServers, "dns", "IP of a name server of the initial network configuration, preferred over those of the rescue system (optional, repeatable)")
+	fs.Var(&ntpServers, "ntp", "IP of an NTP server of the initial network configuration, preferred over Cloudflare (optional, repeatable)")
+	privateDNSFlag := fs.Bool("private-dns", false, "keep private name servers of the rescue system (like 10.0.0.53) for the initial network configuration")
+	verifyFlag := fs.Bool("verify", false, "read back the written system disk and compare it with the image")
+	events := fs.String("events", "", "emit machine-readable events to stdout, supported format: ndjson (optional)")
+	var kernelArgs, removeKernelArgs stringsFlag
+	fs.Var(&kernelArgs, "kernel-arg", "kernel argument key=value (or key) set on the kernel command line, replacing the arguments of the key, like talos.dashboard.disabled=1 or console= (optional, repeatable)")
+	fs.Var(&removeKernelArgs, "remove-kernel-arg", "key of the kernel arguments removed from the kernel command line, like console (optional, repeatable)")
+	sideroLinkAPI := fs.String("siderolink-api", "", "SideroLink API URL of Omni with the join token, like https://<account>.siderolink.omni.siderolabs.io?jointoken=<token>, sets siderolink.api, talos.events.sink and talos.logging.kernel (optional)")
+	serialConsole := fs.String("serial-console", "auto", "serial console of Talos besides the screen, like ttyS1,115200n8, auto detects the one in use (like IPMI Serial-over-LAN), none keeps the consoles of the image")
+	rebootFlag := fs.Bool("reboot", false, "reboot the server")
+	extensionsSchematicFlag := fs.Bool("extensions-schematic", false, "create an Image Factory schematic with the system extensions recommended for the hardware and report its ID")
+	prefetchFlag := fs.Bool("prefetch", false, "download the image to the rescue system (staged in its RAM backed /tmp) while the inventory is being collected and the disks are being prepared, instead of streaming it while writing")
+	forceRewriteFlag := fs.Bool("force-rewrite", false, "wipe and write the system disk even if the image is installed already")
 
-	flag.Parse()
+	fs.Parse(arguments)
 
 	if *versionFlag {
 		fmt.Printf("totalos v%s\n", version)
@@ -63,12 +151,132 @@ func NewCallArgs() *CallArgs {
 	}
 	if *ip == "" {
 		fmt.Println("Error: --ip flag is required")
-		flag.Usage()
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *events != "" && *events != "ndjson" {
+		fmt.Println("Error: --events supports ndjson only")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *imageSHA256 != "" && !regexp.MustCompile(`^[0-9a-fA-F]{64}$`).MatchString(*imageSHA256) {
+		fmt.Println("Error: --image-sha256 must be 64 hexadecimal characters")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if len(imageMirrors) > 0 && *secureBootImage != "" {
+		fmt.Println("Error: --image-mirror cannot be combined with --secureboot-image")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if len(imageMirrors) > 0 && *imageURL == "" {
+		fmt.Println("Error: --image-mirror requires --image")
+		fs.Usage()
+		os.Exit(1)
+	}
+	for _, scheme := range []string{image.OCIScheme, image.S3Scheme, image.FileScheme} {
+		if strings.HasPrefix(*imageURL, scheme) && (len(imageMirrors) > 0 || *imageCache != "") {
+			fmt.Printf("Error: %s images cannot be combined with --image-mirror or --image-cache\n", scheme)
+			fs.Usage()
+			os.Exit(1)
+		}
+	}
+	if len(imageHeaders) > 0 && *imageCache != "" {
+		fmt.Println("Error: --image-header cannot be combined with --image-cache, the cache does not pass headers upstream")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *metaNetworkFlag && *setStaticInitialNetworkConfigurationFlag {
+		fmt.Println("Error: --meta-network cannot be combined with --static")
+		fs.Usage()
 		os.Exit(1)
 	}
+	if (len(dnsServers) > 0 || len(ntpServers) > 0 || *privateDNSFlag) && !*setStaticInitialNetworkConfigurationFlag && !*metaNetworkFlag {
+		fmt.Println("Error: --dns, --ntp and --private-dns require --static or --meta-network")
+		fs.Usage()
+		os.Exit(1)
+	}
+	for _, addr := range append(append([]string{}, dnsServers...), ntpServers...) {
+		if ip, err := netip.ParseAddr(addr); err != nil || ip.Zone() != "" {
+			fmt.Printf("Error: --dns or --ntp %q is no IP address\n", addr)
+			fs.Usage()
+			os.Exit(1)
+		}
+	}
+	if *overlay != "" && *overlay != "none" {
+		if _, err := image.BoardOverlayByName(*overlay); err != nil {
+			fmt.Printf("Error: --overlay: %s\n", err)
+			fs.Usage()
+			os.Exit(1)
+		}
+	}
+	for _, arg := range kernelArgs {
+		key := kernel.Key(arg)
+		if key == "" || strings.ContainsAny(arg, " \t\n\"") {
+			fmt.Printf("Error: --kernel-arg %q is no key=value or key without whitespace and quotes\n", arg)
+			fs.Usage()
+			os.Exit(1)
+		}
+		if (key == "talos.config" && *config != "") || ((key == "ip" || key == "bond" || key == "vlan") && *setStaticInitialNetworkConfigurationFlag) {
+			fmt.Printf("Error: --kernel-arg %s conflicts with --config or --static\n", key)
+			fs.Usage()
+			os.Exit(1)
+		}
+	}
+	for _, ipOpt := range kernel.Cmdline(kernelArgs).Values("ip") {
+		opt, err := kernel.ParseIPOption(ipOpt)
+		if errors.Is(err, kernel.ErrNoStaticIPOption) {
+			continue
+		}
+		if err == nil {
+			err = opt.Validate()
+		}
+		if err != nil {
+			fmt.Printf("Error: --kernel-arg ip=%s: %s\n", ipOpt, err)
+			fs.Usage()
+			os.Exit(1)
+		}
+	}
+	for _, key := range removeKernelArgs {
+		if key == "" || strings.ContainsAny(key, "= \t\n\"") {
+			fmt.Printf("Error: --remove-kernel-arg %q is no key\n", key)
+			fs.Usage()
+			os.Exit(1)
+		}
+	}
+	if *sideroLinkAPI != "" {
+		if _, err := kernel.SideroLinkArgs(*sideroLinkAPI); err != nil {
+			fmt.Printf("Error: --siderolink-api: %s\n", err)
+			fs.Usage()
+			os.Exit(1)
+		}
+		keys := slices.Clone(removeKernelArgs)
+		for _, arg := range kernelArgs {
+			keys = append(keys, kernel.Key(arg))
+		}
+		for _, key := range keys {
+			if key == "siderolink.api" || key == "talos.events.sink" || key == "talos.logging.kernel" {
+				fmt.Printf("Error: --kernel-arg and --remove-kernel-arg %s conflict with --siderolink-api\n", key)
+				fs.Usage()
+				os.Exit(1)
+			}
+		}
+	}
+	if *serialConsole != "auto" && *serialConsole != "none" {
+		if !regexp.MustCompile(`^tty[A-Za-z]+[0-9]+(,[0-9]+([noe][5-8])?)?$`).MatchString(*serialConsole) {
+			fmt.Printf("Error: --serial-console %q is no device like ttyS1 or ttyS1,115200n8\n", *serialConsole)
+			fs.Usage()
+			os.Exit(1)
+		}
+		if setsConsole(kernelArgs, removeKernelArgs) {
+			fmt.Println("Error: --serial-console conflicts with --kernel-arg console= and --remove-kernel-arg console")
+			fs.Usage()
+			os.Exit(1)
+		}
+	}
 	if *password == "" && *keyPath == "" {
 		fmt.Println("Error: --password or --key required")
-		flag.Usage()
+		fs.Usage()
 		os.Exit(1)
 	}
 	return &CallArgs{
@@ -77,18 +285,51 @@ func NewCallArgs() *CallArgs {
 		User:                                 *user,
 		Password:                             *password,
 		KeyPath:                              *keyPath,
-		Image:                                *image,
+		Image:                                *imageURL,
+		ImageMirrors:                         imageMirrors,
+		ImageHeaders:                         imageHeaders,
+		ImageSHA256:                          strings.ToLower(*imageSHA256),
+		ImageCache:                           *imageCache,
+		DockerConfig:                         *dockerConfig,
+		Overlay:                              *overlay,
+		SecureBootImage:                      *secureBootImage,
+		RescueCache:                          *rescueCache,
 		Webhook:                              *webhook,
 		Config:                               *config,
 		SetStaticInitialNetworkConfiguration: *setStaticInitialNetworkConfigurationFlag,
+		MetaNetwork:                          *metaNetworkFlag,
+		DNS:                                  dnsServers,
+		NTP:                                  ntpServers,
+		PrivateDNS:                           *privateDNSFlag,
+		Verify:                               *verifyFlag,
+		Events:                               *events,
 		Reboot:                               *rebootFlag,
+		ForceRewrite:                         *forceRewriteFlag,
+		Prefetch:                             *prefetchFlag,
+		ExtensionsSchematic:                  *extensionsSchematicFlag,
+		KernelArgs:                           kernelArgs,
+		RemoveKernelArgs:                     removeKernelArgs,
+		SideroLinkAPI:                        *sideroLinkAPI,
+		SerialConsole:                        *serialConsole,
 	}
 }
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "serve-images" {
+		serveImages(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bundle" {
+		bundleCommand(os.Args[2:])
+		return
+	}
 	// Parse and validate arguments and populate CallArgs. Might exit early (--version).
-	args := NewCallArgs()
+	install(NewCallArgs(flag.CommandLine, os.Args[1:]))
+}
 
+// install installs Talos on the server described by args.
+func install(args *CallArgs) {
 	// Context with deadline
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
@@ -103,6 +344,13 @@ func main() {
 			log.Fatal(err)
 		}
 	}
+	// Events: NDJSON on stdout, a progress bar on a terminal or nothing at all
+	var events event.Emitter = event.Nop{}
+	if args.Events == "ndjson" {
+		events = event.NewNDJSON(os.Stdout)
+	} else if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		events = event.NewBar(os.Stderr)
+	}
 	// Disk preferences
 	systemDiskPref := &disk.Preference{
 		IgnoreUSB: true,
@@ -110,14 +358,770 @@ func main() {
 	storageDiskPref := &disk.Preference{}
 
 	// Machine
+	events.Phase("inventory")
 	var mach server.Machine
-	var g errgroup.Group
-	g.SetLimit(5)
-	g.Go(func() error {
+	// The image depends on these, it is being resolved and prefetched
+	// while the rest of the inventory is being collected
+	var early errgroup.Group
+	early.Go(func() error {
 		arch, err := command.Arch(srv, cb)
 		mach.Arch = arch
 		return err
 	})
+	early.Go(func() error {
+		fw, err := command.Firmware(srv, cb)
+		mach.Firmware = fw
+		return err
+	})
+	early.Go(func() error {
+		model, compatible, err := command.DeviceTree(srv, cb)
+		mach.DeviceTree.Model = model
+		mach.DeviceTree.Compatible = compatible
+		return err
+	})
+	early.Go(func() error {
+		consoles, err := command.SerialConsoles(srv, cb)
+		mach.SerialConsoles = consoles
+		return err
+	})
+	if err := early.Wait(); err != nil {
+		log.Fatal(err)
+	}
+	inventory := make(chan error, 1)
+	go func() {
+		inventory <- collectInventory(srv, &mach, cb)
+	}()
+	waitInventory := sync.OnceValue(func() error { return <-inventory })
+
+	// Installation
+	inst := installation.Installation{
+		Image:       args.Image,
+		ImageSHA256: args.ImageSHA256,
+		Rebooting:   args.Reboot,
+		Config:      args.Config,
+	}
+	// If image is not given, query the latest one
+	events.Phase("resolve-image")
+	if args.SecureBootImage != "" && (mach.Firmware.SecureBootEnforced() || mach.Firmware.SetupMode) {
+		inst.Image = args.SecureBootImage
+		inst.ImageSHA256 = "" // of --image
+		inst.SecureBoot = true
+	}
+	imagePref := &image.Preference{CacheEndpoint: args.ImageCache}
+	var source *pushedImage
+	var imageSource image.ImageSource
+	var imageHeaders []string
+	var pickedImage bool // by totalos, its schematic is known
+	if args.Bundle != "" {
+		// Offline: the image of the bundle is pushed over SSH
+		src, err := openBundleSource(args, mach.Arch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer src.Close()
+		source = src.pushedImage
+		inst.Image = src.image.URL
+		inst.ImageSHA256 = src.image.SHA256
+		inst.Bundle = &installation.Bundle{
+			Path:    args.Bundle,
+			Created: src.bundle.Manifest.Created,
+			Version: src.image.Version,
+			Configs: src.configs,
+		}
+	} else if inst.Image == "" {
+		pickedImage = true
+		// Single-board computers boot the image with their board overlay only
+		var overlay *image.Overlay
+		if args.Overlay != "" && args.Overlay != "none" {
+			overlay, _ = image.BoardOverlayByName(args.Overlay) // validated
+		} else if args.Overlay == "" && mach.Arch == "aarch64" {
+			overlay = image.BoardOverlay(mach.DeviceTree.Model, mach.DeviceTree.Compatible)
+		}
+		if overlay != nil {
+			url, err := image.BoardImageURL(ctx, overlay, "", client, imagePref)
+			if err != nil {
+				log.Fatal(err)
+			}
+			inst.Image = url
+			inst.Overlay = overlay.Name
+		} else if mach.Firmware.SetupMode {
+			// The secureboot image enrolls its keys while in setup mode
+			url, err := image.SecureBootImageURL(ctx, mach.Arch, "", client, imagePref)
+			if err != nil {
+				log.Fatal(err)
+			}
+			inst.Image = url
+		} else {
+			imageSource = &image.GitHubSource{Client: client, Preference: imagePref}
+		}
+	} else {
+		// The scheme of the URL picks the source serving the image
+		src, err := newImageSource(inst.Image, args, client, imagePref)
+		if err != nil {
+			log.Fatal(err)
+		}
+		imageSource = src
+	}
+	var imageSize int64 // of the download, 0 if unknown
+	if imageSource != nil {
+		artifact, err := imageSource.Resolve(ctx, mach.Arch, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if artifact.SHA256 != "" {
+			if inst.ImageSHA256 != "" && inst.ImageSHA256 != artifact.SHA256 {
+				log.Fatalf("--image-sha256 %s differs from the SHA-256 %s of %s", inst.ImageSHA256, artifact.SHA256, inst.Image)
+			}
+			inst.ImageSHA256 = artifact.SHA256
+		}
+		inst.ImageReference = artifact.Reference
+		inst.Image = artifact.URL
+		imageSize = artifact.Size
+		imageHeaders = artifact.Headers
+		if artifact.Open != nil {
+			// Local images are pushed over SSH
+			pushed, err := openPushedImage(artifact.Open, artifact.URL, artifact.Size)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer pushed.Close()
+			source = pushed
+		}
+	}
+	if image.IsSecureBootImage(inst.Image) || image.IsSecureBootImage(inst.ImageReference) {
+		inst.SecureBoot = true
+	}
+	if mach.Firmware.SecureBootEnforced() && !inst.SecureBoot {
+		log.Fatalf("Secure Boot is enforced by the firmware of %s, it does not boot the unsigned image %s. "+
+			"Pass --secureboot-image with an image signed by keys enrolled in the firmware, "+
+			"or put the firmware into setup mode to install the Talos secureboot image, or disable Secure Boot.",
+			args.IP, inst.Image)
+	}
+	// Unified kernel images (systemd-boot) carry their command line baked
+	// in, so the Image Factory rebuilds the image with the kernel arguments
+	// before any disk is being touched
+	var kernelEdit *kernel.Edit
+	talosVersion := boot.Version(inst.Image)
+	if inst.Bundle != nil {
+		talosVersion = inst.Bundle.Version
+	} else if talosVersion == "" {
+		talosVersion = boot.Version(inst.ImageReference)
+	}
+	bootloader := boot.ExpectedBootloader(talosVersion, mach.Firmware.Mode == "uefi", inst.SecureBoot)
+	// Images of other schematics may carry the kernel arguments already,
+	// which is verified after writing
+	_, knownSchematic := image.FactoryVariant(inst.Image, "", imagePref)
+	knownSchematic = knownSchematic && (pickedImage || image.SchematicOf(inst.Image) == "")
+	// A detected serial console is not worth a rebuild, which gives up the
+	// published digest of the image. It is applied where grub.cfg can be
+	// edited, or along with a rebuild for other kernel arguments.
+	serialConsole := args.SerialConsoleOption(&mach)
+	rebuild := (args.EditsKernelArgs() || args.SerialConsole != "auto" && serialConsole != "") && bootloader == "systemd-boot" && knownSchematic
+	if args.SerialConsole == "auto" && serialConsole != "" && bootloader == "systemd-boot" && !rebuild {
+		log.Printf("warning: %s boots through systemd-boot, the detected serial console %s is not set (see --serial-console)", inst.Image, serialConsole)
+		serialConsole = ""
+	}
+	if rebuild {
+		if source != nil || len(args.ImageMirrors) > 0 {
+			log.Fatalf("%s boots unified kernel images through systemd-boot on %s, whose kernel command line is baked in. "+
+				"The Image Factory cannot rebuild pushed images or images with --image-mirror with the kernel arguments, "+
+				"pass an Image Factory image with them as extraKernelArgs of its schematic.",
+				inst.Image, args.IP)
+		}
+		if err := waitInventory(); err != nil {
+			log.Fatal(err)
+		}
+		edit, err := kernelEditFor(srv, args, &mach, &inst, serialConsole, cb)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kernelEdit = edit
+		schematic := &image.Schematic{Customization: &image.Customization{ExtraKernelArgs: edit.ExtraKernelArgs()}}
+		if inst.Overlay != "" {
+			schematic.Overlay, _ = image.BoardOverlayByName(inst.Overlay)
+		}
+		if args.ExtensionsSchematic {
+			if exts := extension.Extensions(extension.Recommend(&mach, extension.Rules)); len(exts) > 0 {
+				schematic.Customization.SystemExtensions = &image.SystemExtensions{OfficialExtensions: exts}
+			}
+		}
+		id, err := image.SchematicID(ctx, schematic, client, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inst.Image, _ = image.FactoryVariant(inst.Image, id, imagePref)
+		inst.ImageSHA256 = "" // of the release image
+		inst.ImageReference = ""
+		imageSize = 0
+		inst.SchematicID = id
+	}
+	for _, url := range append([]string{inst.Image}, args.ImageMirrors...) {
+		if err := image.CheckArch(url, mach.Arch); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Pick the fastest reachable mirror, the others are kept for failover
+	if len(args.ImageMirrors) > 0 {
+		urls, err := command.FastestImageMirrors(srv, append([]string{inst.Image}, args.ImageMirrors...), cb)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inst.Image, inst.ImageMirrors = urls[0], urls[1:]
+	}
+	// Start downloading right away, the rescue system keeps the image
+	// until it is being written, provided it has room for it. Rescue
+	// caches keep it anyway.
+	var prefetch string
+	if source == nil && args.Prefetch && args.RescueCache == "" {
+		stage, err := command.PrefetchImage(srv, inst.Image, &command.InstallOptions{Mirrors: inst.ImageMirrors, Headers: imageHeaders, Size: imageSize}, cb)
+		if errors.Is(err, command.ErrPrefetchSkipped) {
+			log.Printf("%s, streaming the image while writing", err)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		prefetch = stage
+	}
+	// Detect the image format by its content before touching any disk
+	if source == nil {
+		imageFormat, err := command.ImageFormat(srv, inst.Image, imageHeaders, cb)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inst.ImageFormat = imageFormat
+	} else {
+		inst.ImageFormat = source.format
+	}
+	if err := waitInventory(); err != nil {
+		log.Fatal(err)
+	}
+	// Construct IPv4 CIDR notation for Talos link config.
+	ip := net.ParseIP(mach.IPv4Network.IP).To4()
+	netmask := net.ParseIP(mach.IPv4Network.Netmask).To4()
+	if ip != nil && netmask != nil {
+		mask := net.IPMask(netmask)
+		ones, bits := mask.Size()
+		if bits == 32 { // IPv4
+			mach.IPv4Network.CIDR = fmt.Sprintf("%s/%d", ip.String(), ones)
+		}
+	}
+	// Kernel arguments are built and validated before any disk is touched
+	if kernelEdit == nil {
+		edit, err := kernelEditFor(srv, args, &mach, &inst, serialConsole, cb)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kernelEdit = edit
+	}
+	// System extensions the hardware asks for
+	inst.RecommendedExtensions = extension.Recommend(&mach, extension.Rules)
+	if len(inst.RecommendedExtensions) > 0 && args.ExtensionsSchematic && inst.SchematicID == "" {
+		schematic := &image.Schematic{Customization: &image.Customization{
+			SystemExtensions: &image.SystemExtensions{OfficialExtensions: extension.Extensions(inst.RecommendedExtensions)},
+		}}
+		if inst.Overlay != "" {
+			schematic.Overlay, _ = image.BoardOverlayByName(inst.Overlay)
+		}
+		id, err := image.SchematicID(ctx, schematic, client, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inst.SchematicID = id
+	} else if !args.ExtensionsSchematic && (image.SchematicOf(inst.Image) == "" || inst.SchematicID != "") {
+		for _, rec := range inst.RecommendedExtensions {
+			log.Printf("warning: %s asks for the system extension %s, which the image lacks (see --extensions-schematic)", rec.Reason, rec.Extension)
+		}
+	}
+	// Select system disk
+	systemDisk, err := disk.SelectSystemDisk(mach.Disks, systemDiskPref)
+	if err != nil {
+		log.Fatal(err)
+	}
+	inst.SystemDisk = systemDisk
+	installOpts := &command.InstallOptions{
+		Mirrors:  inst.ImageMirrors,
+		SHA256:   inst.ImageSHA256,
+		CacheDir: args.RescueCache,
+		Headers:  imageHeaders,
+		Prefetch: prefetch,
+		Verify:   args.Verify,
+		Progress: func(p command.Progress) {
+			events.Progress(p.Downloaded, p.Written, p.Size)
+		},
+	}
+	if source != nil {
+		installOpts.Source = source
+		installOpts.Size = source.size
+	}
+	// An earlier run might have written the same image already
+	if !args.ForceRewrite {
+		events.Phase("check-installed")
+		installed, err := imageInstalled(srv, &inst, installOpts, source, cb)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inst.ImageAlreadyInstalled = installed
+	}
+	if inst.ImageAlreadyInstalled && prefetch != "" {
+		if err := command.StopPrefetch(srv, prefetch, cb); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if !inst.ImageAlreadyInstalled {
+		// Reset disks
+		events.Phase("wipe")
+		if err := command.SoftwareRAIDNotExists(srv, cb); err != nil {
+			log.Fatal(err)
+		}
+		if err := command.WipeFileSystemSignatures(srv, cb); err != nil {
+			log.Fatal(err)
+		}
+		// Write image data on the system disk
+		events.Phase("install-image")
+		installResult, err := command.InstallRawImage(srv, inst.Image, inst.ImageFormat, inst.SystemDisk.Device(), installOpts, cb)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Read back the system disk before anything else modifies it
+		if args.Verify {
+			events.Phase("verify")
+			start := time.Now()
+			diskSHA256, err := command.ReadBackSHA256(srv, inst.SystemDisk.Device(), installResult.Bytes, cb)
+			if err != nil {
+				log.Fatal(err)
+			}
+			inst.Verification = &installation.Verification{
+				Bytes:           installResult.Bytes,
+				ImageSHA256:     installResult.SHA256,
+				DiskSHA256:      diskSHA256,
+				Match:           diskSHA256 == installResult.SHA256,
+				DurationSeconds: time.Since(start).Seconds(),
+			}
+			// The report tells about the mismatch, the installation stops
+			if !inst.Verification.Match {
+				log.Printf(
+					"verification of %s failed: image sha256 %s, disk sha256 %s (%d bytes)",
+					inst.SystemDisk.Device(), installResult.SHA256, diskSHA256, installResult.Bytes,
+				)
+				events.Phase("report")
+				if err := emitReport(ctx, client, args, events, &installation.Report{Installation: inst, Machine: mach}); err != nil {
+					log.Print(err)
+				}
+				os.Exit(1)
+			}
+		}
+		// Record the complete image for later runs
+		headBytes := min(int64(command.ImageHeadSize), installResult.Bytes)
+		headSHA256, err := command.ReadBackSHA256(srv, inst.SystemDisk.Device(), headBytes, cb)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rec := &command.InstalledImage{
+			Image:       inst.Image,
+			ImageSHA256: inst.ImageSHA256,
+			Bytes:       installResult.Bytes,
+			HeadBytes:   headBytes,
+			HeadSHA256:  headSHA256,
+			Installed:   time.Now().UTC(),
+		}
+		if err := command.WriteInstalledImage(srv, inst.SystemDisk.Device(), rec, cb); err != nil {
+			log.Fatal(err)
+		}
+	}
+	events.Phase("configure")
+	// Images booting unified kernel images only have no grub.cfg, their
+	// kernel arguments are baked in by the Image Factory
+	if !kernelEdit.Empty() {
+		if _, err := command.EditKernelArgs(srv, inst.SystemDisk.Device(), kernelEdit, cb); err != nil && !errors.Is(err, command.ErrNoGrubConfig) {
+			log.Fatal(err)
+		}
+	}
+	// Read back how the written image boots, including the changes above
+	bootInfo, err := command.BootInfo(srv, inst.SystemDisk.Device(), cb)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The report leaves out the join token of Omni
+	reportedBoot := *bootInfo
+	reportedBoot.KernelArgs = kernel.RedactJoinTokens(bootInfo.KernelArgs)
+	inst.Boot = &reportedBoot
+	// A detected serial console is a convenience, images of other
+	// schematics may lack it
+	required := kernelEdit
+	if args.SerialConsole == "auto" && serialConsole != "" {
+		required = &kernel.Edit{Set: slices.DeleteFunc(slices.Clone(kernelEdit.Set), func(arg string) bool {
+			return kernel.Key(arg) == "console"
+		}), Remove: kernelEdit.Remove}
+	}
+	if !kernelEdit.Satisfied(bootInfo.KernelArgs) && required.Satisfied(bootInfo.KernelArgs) {
+		log.Printf("warning: %s boots without the serial console %s (bootloader %q)", inst.Image, serialConsole, bootInfo.Bootloader)
+	} else if serialConsole != "" {
+		inst.SerialConsole = serialConsole
+	}
+	// Talos booting without the kernel arguments would come up without its
+	// configuration, rather leave the disks empty
+	if !required.Satisfied(bootInfo.KernelArgs) {
+		if err := command.WipeFileSystemSignatures(srv, cb); err != nil {
+			log.Fatal(err)
+		}
+		log.Fatalf("%s boots without the kernel arguments %s (bootloader %q), the disks have been wiped again. "+
+			"Pass an Image Factory image with them as extraKernelArgs of its schematic, "+
+			"or a Talos release image (without --image-mirror) for totalos to have it rebuilt.",
+			inst.Image, strings.Join(kernel.RedactJoinTokens(kernelEdit.ExtraKernelArgs()), " "), bootInfo.Bootloader)
+	}
+	if args.SideroLinkAPI != "" {
+		for _, key := range []string{"siderolink.api", "talos.events.sink", "talos.logging.kernel"} {
+			for _, value := range kernel.Cmdline(reportedBoot.KernelArgs).Values(key) {
+				inst.SideroLinkKernelArgs = append(inst.SideroLinkKernelArgs, key+"="+value)
+			}
+		}
+	}
+	if args.Config != "" {
+		inst.Config, _ = kernel.Cmdline(bootInfo.KernelArgs).Get("talos.config")
+	}
+	if args.SetStaticInitialNetworkConfiguration {
+		// Only static options count, like those of --static
+		for _, ipOpt := range kernel.Cmdline(bootInfo.KernelArgs).Values("ip") {
+			parsed, err := kernel.ParseIPOption(ipOpt)
+			if err != nil {
+				continue
+			}
+			switch parsed.(type) {
+			case *kernel.IPOptionStaticV4:
+				inst.StaticInitialNetworkConfiguration = ipOpt
+			case *kernel.IPOptionStaticV6:
+				inst.StaticInitialNetworkConfigurationV6 = ipOpt
+			}
+		}
+	}
+	// Network config for maintenance mode in the META partition, Talos
+	// applies it on boot (until the machine config replaces it)
+	if args.MetaNetwork {
+		networkConfig, err := meta.NewNetworkConfig(&mach, installation.ChosenAddresses(inst.NameServers), installation.ChosenAddresses(inst.TimeServers))
+		if err != nil {
+			log.Fatal(err)
+		}
+		value, err := networkConfig.YAML()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := command.WriteMetaKey(srv, inst.SystemDisk.Device(), meta.MetalNetworkPlatformConfig, value, cb); err != nil {
+			log.Fatal(err)
+		}
+		inst.MetaNetworkConfig = networkConfig
+	}
+	// Select storage disk
+	storageDisk, err := disk.SelectStorageDisk(mach.Disks, systemDisk, storageDiskPref)
+	if err != nil {
+		log.Fatal(err)
+	}
+	inst.StorageDisk = storageDisk
+	// Create report and print it to stdout (NDJSON: as an event)
+	events.Phase("report")
+	if err := emitReport(ctx, client, args, events, &installation.Report{Installation: inst, Machine: mach}); err != nil {
+		log.Fatal(err)
+	}
+	// Reboot (if requested)
+	if args.Reboot {
+		events.Phase("reboot")
+		command.Reboot(srv, cb)
+	}
+}
+
+// emitReport hands the report to the events (NDJSON: as done event),
+// prints it to stdout unless emitting NDJSON and POSTs it to the webhook
+// (if given).
+func emitReport(ctx context.Context, client *http.Client, args *CallArgs, events event.Emitter, report *installation.Report) error {
+	jsonData, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	events.Done(*report)
+	if args.Events != "ndjson" {
+		fmt.Println(string(jsonData))
+	}
+	if args.Webhook == "" {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		args.Webhook,
+		bytes.NewReader(jsonData),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("totalos/%s", version))
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// imageInstalled tells whether an earlier run has written the image to
+// the system disk completely, and the disk has not been touched since
+// (apart from the boot and META partitions). The image is compared by
+// its digest if known, by the digest of its leading region otherwise.
+func imageInstalled(srv remotecommand.Machine, inst *installation.Installation, opts *command.InstallOptions, source *pushedImage, cb ssh.HostKeyCallback) (bool, error) {
+	device := inst.SystemDisk.Device()
+	rec, err := command.ReadInstalledImage(srv, device, cb)
+	if err != nil || rec == nil {
+		return false, err
+	}
+	if rec.ImageSHA256 == "" || rec.ImageSHA256 != inst.ImageSHA256 {
+		headOpts := &command.InstallOptions{Headers: opts.Headers}
+		if source != nil {
+			rc, err := source.open()
+			if err != nil {
+				return false, err
+			}
+			defer rc.Close()
+			headOpts.Source = rc
+		}
+		head, err := command.ImageHeadSHA256(srv, inst.Image, inst.ImageFormat, headOpts, cb)
+		if err != nil {
+			return false, err
+		}
+		if head.Bytes != rec.HeadBytes || head.SHA256 != rec.HeadSHA256 {
+			return false, nil
+		}
+	}
+	diskSHA256, err := command.ReadBackSHA256(srv, device, rec.HeadBytes, cb)
+	if err != nil {
+		return false, err
+	}
+	return diskSHA256 == rec.HeadSHA256, nil
+}
+
+// kernelEditFor returns the kernel arguments to set and remove: those
+// of --kernel-arg and --remove-kernel-arg, talos.config of --config and
+// ip of --static, console of the serial console. It looks up the name
+// servers of the machine and chooses those of the initial network
+// configuration (see chooseNetworkServers).
+func kernelEditFor(srv remotecommand.Machine, args *CallArgs, mach *server.Machine, inst *installation.Installation, serialConsole string, cb ssh.HostKeyCallback) (*kernel.Edit, error) {
+	edit := &kernel.Edit{Set: args.KernelArgs, Remove: args.RemoveKernelArgs}
+	if serialConsole != "" {
+		edit.Set = append(edit.Set, kernel.ConsoleArgs(serialConsole)...)
+	}
+	// If config is given, set it as talos.config option
+	if args.Config != "" {
+		edit.Set = append(edit.Set, "talos.config="+args.Config)
+	}
+	// Joining Omni over SideroLink
+	if args.SideroLinkAPI != "" {
+		sideroLinkArgs, err := kernel.SideroLinkArgs(args.SideroLinkAPI)
+		if err != nil {
+			return nil, err
+		}
+		edit.Set = append(edit.Set, sideroLinkArgs...)
+	}
+	// Domain name servers (IPv4)
+	if resolvers, err := command.ResolvectlDNSv4(srv, args.PrivateDNS, cb); err == nil && len(resolvers) > 0 {
+		mach.IPv4Network.ResolversV4 = resolvers
+	} else if resolvers, err := command.ResolveconfDNSv4(srv, args.PrivateDNS, cb); err == nil {
+		mach.IPv4Network.ResolversV4 = resolvers
+	}
+	// Domain name servers (IPv6)
+	if resolvers, err := command.ResolvectlDNSv6(srv, args.PrivateDNS, cb); err == nil && len(resolvers) > 0 {
+		mach.IPv4Network.ResolversV6 = resolvers
+	} else if resolvers, err := command.ResolveconfDNSv6(srv, args.PrivateDNS, cb); err == nil {
+		mach.IPv4Network.ResolversV6 = resolvers
+	}
+	if args.SetStaticInitialNetworkConfiguration || args.MetaNetwork {
+		if err := chooseNetworkServers(srv, args, mach, inst, cb); err != nil {
+			return nil, err
+		}
+	}
+	// Static network config for maintenance mode (util machine config is
+	// applied), one ip= per address family, on the bond or VLAN the rescue
+	// system uses
+	if args.SetStaticInitialNetworkConfiguration {
+		ifaceName := mach.Ethernet.IDNetNames.InterfaceName()
+		if u := mach.Uplink; u != nil {
+			ifaceName = u.TalosInterface()
+			edit.Set = append(edit.Set, uplinkKernelArgs(u)...)
+		}
+		if ifaceName == "" {
+			return nil, errors.New("cannot determine name for ethernet interface")
+		}
+		hasIPv4 := net.ParseIP(mach.IPv4Network.IP).To4() != nil
+		hasIPv6 := mach.IPv6Network.CIDR != "" && mach.IPv6Network.Gateway != ""
+		if !hasIPv4 && !hasIPv6 {
+			return nil, errors.New("cannot determine IPv4 or IPv6 address and gateway for ethernet interface")
+		}
+		hostname := strings.ReplaceAll(mach.IPv4Network.IP, ".", "-")
+		if !hasIPv4 {
+			hostname = strings.ReplaceAll(mach.IPv6Network.IP, ":", "-")
+		}
+		if hasIPv4 {
+			dns := append(chosenOf(inst.NameServers, false), "", "")
+			ntp := append(chosenOf(inst.TimeServers, false), "")
+			ipOpt := &kernel.IPOptionStaticV4{
+				ClientIP:  mach.IPv4Network.IP,
+				GatewayIP: mach.IPv4Network.Gateway,
+				Netmask:   mach.IPv4Network.Netmask,
+				Hostname:  hostname,
+				Device:    ifaceName,
+				DNS0IP:    dns[0],
+				DNS1IP:    dns[1],
+				NTP0IP:    ntp[0],
+			}
+			if err := ipOpt.Validate(); err != nil {
+				return nil, fmt.Errorf("static IPv4 network configuration: %w", err)
+			}
+			edit.Set = append(edit.Set, "ip="+ipOpt.String())
+		}
+		if hasIPv6 {
+			dns := append(chosenOf(inst.NameServers, true), "", "")
+			ntp := append(chosenOf(inst.TimeServers, true), "")
+			_, ipv6Net, err := net.ParseCIDR(mach.IPv6Network.CIDR)
+			if err != nil {
+				return nil, err
+			}
+			prefixLength, _ := ipv6Net.Mask.Size()
+			ipOpt := &kernel.IPOptionStaticV6{
+				ClientIP:     mach.IPv6Network.IP,
+				PrefixLength: prefixLength,
+				GatewayIP:    mach.IPv6Network.Gateway,
+				Hostname:     hostname,
+				Device:       ifaceName,
+				DNS0IP:       dns[0],
+				DNS1IP:       dns[1],
+				NTP0IP:       ntp[0],
+			}
+			if err := ipOpt.Validate(); err != nil {
+				return nil, fmt.Errorf("static IPv6 network configuration: %w", err)
+			}
+			edit.Set = append(edit.Set, "ip="+ipOpt.String())
+		}
+	}
+	return edit, nil
+}
+
+// Fallback name and time servers of the initial network configuration
+var (
+	fallbackDNSv4 = []string{"1.1.1.1", "8.8.8.8"}                           // Cloudflare, Google
+	fallbackDNSv6 = []string{"2606:4700:4700::1111", "2001:4860:4860::8888"} // Cloudflare, Google
+	fallbackNTPv4 = []string{"162.159.200.1"}                                // Cloudflare
+	fallbackNTPv6 = []string{"2606:4700:f1::1"}                              // Cloudflare
+)
+
+// chooseNetworkServers chooses two name servers and one time server per
+// address family of the machine for the initial network configuration.
+// The candidates are those of --dns and --ntp, the resolvers of the rescue
+// system and the fallbacks, in this order. They are probed from the rescue
+// system and the first ones answering are chosen, which is reported with
+// the reasons as name_servers and time_servers.
+func chooseNetworkServers(srv remotecommand.Machine, args *CallArgs, mach *server.Machine, inst *installation.Installation, cb ssh.HostKeyCallback) error {
+	var families []bool // IPv6
+	if net.ParseIP(mach.IPv4Network.IP).To4() != nil {
+		families = append(families, false)
+	}
+	if mach.IPv6Network.CIDR != "" {
+		families = append(families, true)
+	}
+	var dnsCandidates, ntpCandidates [2][]installation.ServerChoice
+	var dnsAddrs, ntpAddrs []string
+	for _, v6 := range families {
+		i := 0
+		rescue, fallbackDNS, fallbackNTP := mach.IPv4Network.ResolversV4, fallbackDNSv4, fallbackNTPv4
+		if v6 {
+			i = 1
+			rescue, fallbackDNS, fallbackNTP = mach.IPv4Network.ResolversV6, fallbackDNSv6, fallbackNTPv6
+		}
+		for _, c := range []struct {
+			source string
+			addrs  []string
+		}{{"flag", ofFamily(args.DNS, v6)}, {"rescue", rescue}, {"fallback", fallbackDNS}} {
+			for _, addr := range c.addrs {
+				dnsCandidates[i] = append(dnsCandidates[i], installation.ServerChoice{Address: addr, Source: c.source})
+				dnsAddrs = append(dnsAddrs, addr)
+			}
+		}
+		for _, c := range []struct {
+			source string
+			addrs  []string
+		}{{"flag", ofFamily(args.NTP, v6)}, {"fallback", fallbackNTP}} {
+			for _, addr := range c.addrs {
+				ntpCandidates[i] = append(ntpCandidates[i], installation.ServerChoice{Address: addr, Source: c.source})
+				ntpAddrs = append(ntpAddrs, addr)
+			}
+		}
+	}
+	dnsProbes, err := command.ProbeDNS(srv, dnsAddrs, cb)
+	if err != nil {
+		return err
+	}
+	ntpProbes, err := command.ProbeNTP(srv, ntpAddrs, cb)
+	if err != nil {
+		return err
+	}
+	inst.NameServers, inst.TimeServers = nil, nil
+	for i := range dnsCandidates {
+		inst.NameServers = append(inst.NameServers, installation.ChooseServers(dnsCandidates[i], dnsProbes, 2)...)
+		inst.TimeServers = append(inst.TimeServers, installation.ChooseServers(ntpCandidates[i], ntpProbes, 1)...)
+	}
+	for _, c := range append(append([]installation.ServerChoice{}, inst.NameServers...), inst.TimeServers...) {
+		if c.Source == "flag" && !c.Chosen {
+			log.Printf("warning: %s of --dns or --ntp is left out: %s", c.Address, c.Reason)
+		} else if c.Chosen && c.Reason != "answered" {
+			log.Printf("warning: %s is used %s", c.Address, c.Reason)
+		}
+	}
+	return nil
+}
+
+// ofFamily returns the IPv4 (or IPv6) addresses.
+func ofFamily(addrs []string, v6 bool) []string {
+	var out []string
+	for _, addr := range addrs {
+		if ip, err := netip.ParseAddr(addr); err == nil && ip.Is6() == v6 {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// chosenOf returns the chosen IPv4 (or IPv6) addresses.
+func chosenOf(choices []installation.ServerChoice, v6 bool) []string {
+	return ofFamily(installation.ChosenAddresses(choices), v6)
+}
+
+// uplinkKernelArgs returns the bond= and vlan= kernel arguments bringing
+// up the uplink under Talos, with the interface names of Talos.
+func uplinkKernelArgs(u *server.Uplink) []string {
+	var args []string
+	parent := ""
+	if u.Bond != nil {
+		bond := &kernel.BondOption{Name: u.Bond.Name, Options: u.Bond.Options}
+		if u.Bond.Mode != "" {
+			bond.Options = append([]string{"mode=" + u.Bond.Mode}, bond.Options...)
+		}
+		for _, l := range u.Links {
+			bond.Slaves = append(bond.Slaves, l.TalosName())
+		}
+		if u.VLAN == nil && u.MTU != 1500 {
+			bond.MTU = u.MTU
+		}
+		args = append(args, "bond="+bond.String())
+		parent = u.Bond.Name
+	} else if len(u.Links) > 0 {
+		parent = u.Links[0].TalosName()
+	}
+	if u.VLAN != nil && parent != "" {
+		vlan := &kernel.VLANOption{Parent: parent, ID: u.VLAN.ID}
+		args = append(args, "vlan="+vlan.String())
+	}
+	return args
+}
+
+// collectInventory runs the inventory commands (but Arch, Firmware and
+// DeviceTree) concurrently and fills in the machine.
+func collectInventory(srv remotecommand.Machine, mach *server.Machine, cb ssh.HostKeyCallback) error {
+	var g errgroup.Group
+	g.SetLimit(5)
 	g.Go(func() error {
 		ethdevname, err := command.EthernetDeviceName(srv, cb)
 		mach.Ethernet.Device = ethdevname
@@ -139,18 +1143,46 @@ func main() {
 	})
 	g.Go(func() error {
 		ipv4, err := command.IPv4(srv, cb)
-		mach.IPv4Network.IP = ipv4.String()
-		mach.Hostname = fmt.Sprintf("talos-%s", strings.ReplaceAll(ipv4.String(), ".", "-"))
+		if ipv4 != nil {
+			mach.IPv4Network.IP = ipv4.String()
+			mach.Hostname = fmt.Sprintf("talos-%s", strings.ReplaceAll(ipv4.String(), ".", "-"))
+		}
 		return err
 	})
 	g.Go(func() error {
 		nm, err := command.IPv4Netmask(srv, cb)
-		mach.IPv4Network.Netmask = nm.String()
+		if nm != nil {
+			mach.IPv4Network.Netmask = nm.String()
+		}
 		return err
 	})
 	g.Go(func() error {
 		gw, err := command.IPv4Gateway(srv, cb)
-		mach.IPv4Network.Gateway = gw.String()
+		if gw != nil {
+			mach.IPv4Network.Gateway = gw.String()
+		}
+		return err
+	})
+	g.Go(func() error {
+		uplink, err := command.Uplink(srv, cb)
+		mach.Uplink = uplink
+		return err
+	})
+	g.Go(func() error {
+		ipv6, err := command.IPv6(srv, cb)
+		if ipv6 != nil {
+			ones, _ := ipv6.Mask.Size()
+			mach.IPv6Network.IP = ipv6.IP.String()
+			mach.IPv6Network.Netmask = net.IP(ipv6.Mask).String()
+			mach.IPv6Network.CIDR = fmt.Sprintf("%s/%d", ipv6.IP, ones)
+		}
+		return err
+	})
+	g.Go(func() error {
+		gw, err := command.IPv6Gateway(srv, cb)
+		if gw != nil {
+			mach.IPv6Network.Gateway = gw.String()
+		}
 		return err
 	})
 	g.Go(func() error {
@@ -233,138 +1265,17 @@ func main() {
 		mach.Disks = disks
 		return err
 	})
+	g.Go(func() error {
+		devices, err := command.PCIDevices(srv, cb)
+		mach.PCIDevices = devices
+		return err
+	})
 	if err := g.Wait(); err != nil {
-		log.Fatal(err)
-	}
-
-	// Construct IPv4 CIDR notation for Talos link config.
-	ip := net.ParseIP(mach.IPv4Network.IP).To4()
-	netmask := net.ParseIP(mach.IPv4Network.Netmask).To4()
-	if ip != nil && netmask != nil {
-		mask := net.IPMask(netmask)
-		ones, bits := mask.Size()
-		if bits == 32 { // IPv4
-			mach.IPv4Network.CIDR = fmt.Sprintf("%s/%d", ip.String(), ones)
-		}
-	}
-
-	// Installation
-	inst := installation.Installation{
-		Image:     args.Image,
-		Rebooting: args.Reboot,
-		Config:    args.Config,
-	}
-	// If image is not given, query the latest one
-	if inst.Image == "" {
-		url, err := image.LatestImageURL(ctx, mach.Arch, client)
-		if err != nil {
-			log.Fatal(err)
-		}
-		inst.Image = url
-	}
-	// Reset disks
-	if err := command.SoftwareRAIDNotExists(srv, cb); err != nil {
-		log.Fatal(err)
-	}
-	if err := command.WipeFileSystemSignatures(srv, cb); err != nil {
-		log.Fatal(err)
-	}
-	// Select system disk and write image data on it
-	systemDisk, err := disk.SelectSystemDisk(mach.Disks, systemDiskPref)
-	if err != nil {
-		log.Fatal(err)
-	}
-	inst.SystemDisk = systemDisk
-	if err := command.InstallRawImage(srv, inst.Image, inst.SystemDisk.Device(), cb); err != nil {
-		log.Fatal(err)
-	}
-	// If config is given, set it as talos.config option in grub.cfg
-	if args.Config != "" {
-		configThatGotSet, err := command.SetConfigURL(srv, args.Config, inst.SystemDisk.Device(), cb)
-		if err != nil {
-			log.Fatal(err)
-		}
-		inst.Config = configThatGotSet
-	}
-	// Domain name servers (IPv4)
-	if resolvers, err := command.ResolvectlDNSv4(srv, cb); err == nil && len(resolvers) > 0 {
-		mach.IPv4Network.ResolversV4 = resolvers
-	} else if resolvers, err := command.ResolveconfDNSv4(srv, cb); err == nil {
-		mach.IPv4Network.ResolversV4 = resolvers
-	}
-	// Domain name servers (IPv6)
-	if resolvers, err := command.ResolvectlDNSv6(srv, cb); err == nil && len(resolvers) > 0 {
-		mach.IPv4Network.ResolversV6 = resolvers
-	} else if resolvers, err := command.ResolveconfDNSv6(srv, cb); err == nil {
-		mach.IPv4Network.ResolversV6 = resolvers
-	}
-	// Static network config for maintenance mode (util machine config is applied)
-	if args.SetStaticInitialNetworkConfiguration {
-		ifaceName := mach.Ethernet.IDNetNames.InterfaceName()
-		if ifaceName == "" {
-			log.Fatal("cannot determine name for ethernet interface")
-		}
-		dns0 := "1.1.1.1" // Cloudflare as fallback
-		if resolvers := mach.IPv4Network.ResolversV4; len(resolvers) > 0 {
-			dns0 = resolvers[0]
-		}
-		dns1 := "8.8.8.8" // Google as fallback
-		if resolvers := mach.IPv4Network.ResolversV4; len(resolvers) > 1 {
-			dns1 = resolvers[1]
-		}
-		ipOpt := &kernel.IPOptionStaticV4{
-			ClientIP:  mach.IPv4Network.IP,
-			GatewayIP: mach.IPv4Network.Gateway,
-			Netmask:   mach.IPv4Network.Netmask,
-			Hostname:  strings.ReplaceAll(mach.IPv4Network.IP, ".", "-"),
-			Device:    ifaceName,
-			DNS0IP:    dns0,
-			DNS1IP:    dns1,
-			NTP0IP:    "162.159.200.1", // Cloudflare
-		}
-		ipOptThatGotSet, err := command.SetIPOptionStaticV4(srv, ipOpt, inst.SystemDisk.Device(), cb)
-		if err != nil {
-			log.Fatal(err)
-		}
-		inst.StaticInitialNetworkConfiguration = ipOptThatGotSet
-	}
-	// Select storage disk
-	storageDisk, err := disk.SelectStorageDisk(mach.Disks, systemDisk, storageDiskPref)
-	if err != nil {
-		log.Fatal(err)
-	}
-	inst.StorageDisk = storageDisk
-	// Create report and print it to stdout
-	report := installation.Report{
-		Installation: inst,
-		Machine:      mach,
-	}
-	jsonData, err := json.MarshalIndent(report, "", "  ")
-	if err != nil {
-		log.Fatal(err)
-	}
-	fmt.Println(string(jsonData))
-	// Send report to webhook (if given)
-	if args.Webhook != "" {
-		req, err := http.NewRequestWithContext(
-			ctx,
-			http.MethodPost,
-			args.Webhook,
-			bytes.NewReader(jsonData),
-		)
-		if err != nil {
-			log.Fatal(err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("User-Agent", fmt.Sprintf("totalos/%s", version))
-		res, err := client.Do(req)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer res.Body.Close()
+		return err
 	}
-	// Reboot (if requested)
-	if args.Reboot {
-		command.Reboot(srv, cb)
+	// IPv6-only sites
+	if mach.Hostname == "" && mach.IPv6Network.IP != "" {
+		mach.Hostname = fmt.Sprintf("talos-%s", strings.ReplaceAll(mach.IPv6Network.IP, ":", "-"))
 	}
+	return nil
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/fabiant7t/totalos/pkg/imagecache"
+)
+
+// serveImages runs the caching image server (`totalos serve-images`).
+// Installations point to it with --image-cache.
+func serveImages(arguments []string) {
+	fs := flag.NewFlagSet("serve-images", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "address the image server listens on")
+	dir := fs.String("dir", "totalos-images", "directory the images are stored in")
+	var allowHosts stringsFlag
+	fs.Var(&allowHosts, "allow-host", "upstream host images may be fetched from (repeatable, default github.com and factory.talos.dev)")
+	fs.Parse(arguments)
+
+	cache, err := imagecache.New(*dir, &imagecache.Args{AllowHosts: allowHosts})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("serving images from %s on %s", *dir, *listen)
+	log.Fatal(http.ListenAndServe(*listen, cache))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+// newImageSource picks the backend serving the image by the scheme of its
+// URL: oci://, s3://, file:// or http(s)://. S3 credentials, region and
+// endpoint are taken from the AWS_* environment variables.
+func newImageSource(imageURL string, args *CallArgs, client *http.Client, pref *image.Preference) (image.ImageSource, error) {
+	switch {
+	case strings.HasPrefix(imageURL, image.OCIScheme):
+		creds, err := image.LoadDockerConfig(args.DockerConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &image.OCISource{Reference: imageURL, Client: client, Preference: &image.Preference{Credentials: creds}}, nil
+	case strings.HasPrefix(imageURL, image.S3Scheme):
+		s, err := image.NewS3Source(imageURL)
+		if err != nil {
+			return nil, err
+		}
+		s.Endpoint = os.Getenv("AWS_ENDPOINT_URL_S3")
+		if s.Endpoint == "" {
+			s.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+		}
+		s.Region = os.Getenv("AWS_REGION")
+		s.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		s.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		s.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		s.Client = client
+		return s, nil
+	case strings.HasPrefix(imageURL, image.FileScheme):
+		return image.NewFileSource(imageURL)
+	default:
+		return image.NewHTTPSource(imageURL, args.ImageHeaders, pref)
+	}
+}
+
+// pushedImage streams an image from this machine to the rescue system
+// over SSH, instead of the rescue system downloading it.
+type pushedImage struct {
+	io.ReadCloser
+	open   func() (io.ReadCloser, error)
+	size   int64
+	format image.Format
+}
+
+// openPushedImage detects the format of the image from its head, then
+// opens it again for the installation.
+func openPushedImage(open func() (io.ReadCloser, error), name string, size int64) (*pushedImage, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, image.SniffLength)
+	n, err := io.ReadFull(rc, head)
+	rc.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	format, err := image.DetectFormat(head[:n], "", name)
+	if err != nil {
+		return nil, err
+	}
+	if rc, err = open(); err != nil {
+		return nil, err
+	}
+	return &pushedImage{ReadCloser: rc, open: open, size: size, format: format}, nil
+}
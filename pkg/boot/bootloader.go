@@ -0,0 +1,35 @@
+package boot
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ExpectedBootloader tells how a Talos disk image of the version (like
+// v1.11.3) boots, before it has been written: grub or systemd-boot, empty
+// if the version is unknown. Secure Boot images always boot through
+// systemd-boot. From Talos v1.10 on, images boot through systemd-boot on
+// UEFI firmware as well, and through grub on BIOS firmware only.
+func ExpectedBootloader(talosVersion string, uefi, secureBoot bool) string {
+	if secureBoot {
+		return "systemd-boot"
+	}
+	if !uefi {
+		return "grub"
+	}
+	v := strings.TrimPrefix(Version(talosVersion), "v")
+	majorStr, rest, _ := strings.Cut(v, ".")
+	minorStr, _, _ := strings.Cut(rest, ".")
+	major, err := strconv.Atoi(majorStr)
+	if err != nil {
+		return ""
+	}
+	minor, err := strconv.Atoi(minorStr)
+	if err != nil {
+		return ""
+	}
+	if major > 1 || major == 1 && minor >= 10 {
+		return "systemd-boot"
+	}
+	return "grub"
+}
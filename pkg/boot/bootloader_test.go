@@ -0,0 +1,29 @@
+package boot_test
+
+import (
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/boot"
+)
+
+func TestExpectedBootloader(t *testing.T) {
+	for _, tc := range []struct {
+		version    string
+		uefi       bool
+		secureBoot bool
+		want       string
+	}{
+		{"v1.9.5", true, false, "grub"},
+		{"v1.10.0", true, false, "systemd-boot"},
+		{"v1.11.3", true, false, "systemd-boot"},
+		{"v1.11.3", false, false, "grub"},
+		{"v1.9.5", true, true, "systemd-boot"},
+		{"v2.0.0-alpha.1", true, false, "systemd-boot"},
+		{"", true, false, ""},
+		{"", false, false, "grub"},
+	} {
+		if got := boot.ExpectedBootloader(tc.version, tc.uefi, tc.secureBoot); got != tc.want {
+			t.Errorf("%q uefi=%t secureboot=%t: got %q, want %q", tc.version, tc.uefi, tc.secureBoot, got, tc.want)
+		}
+	}
+}
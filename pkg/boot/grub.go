@@ -0,0 +1,110 @@
+package boot
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/kernel"
+)
+
+// GrubConfig is what a grub.cfg written by Talos tells about booting.
+type GrubConfig struct {
+	// Default is the title of the default menu entry.
+	Default string
+	Entries []GrubEntry
+}
+
+// GrubEntry is a menuentry of grub.cfg.
+type GrubEntry struct {
+	Title string
+	// Kernel is the path of the kernel image, like /A/vmlinuz.
+	Kernel string
+	// Args are the kernel command line arguments.
+	Args []string
+}
+
+var (
+	grubDefault   = regexp.MustCompile(`^set\s+default=["']?([^"']*)["']?$`)
+	grubMenuEntry = regexp.MustCompile(`^menuentry\s+["']([^"']*)["']`)
+	talosVersion  = regexp.MustCompile(`v\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?`)
+)
+
+// ParseGrubConfig parses the default and the menu entries of grub.cfg.
+// Anything else, like submenus or scripting, is ignored.
+func ParseGrubConfig(cfg []byte) *GrubConfig {
+	c := &GrubConfig{}
+	var entry *GrubEntry
+	s := bufio.NewScanner(bytes.NewReader(cfg))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case entry == nil && grubDefault.MatchString(line):
+			c.Default = grubDefault.FindStringSubmatch(line)[1]
+		case entry == nil && grubMenuEntry.MatchString(line):
+			entry = &GrubEntry{Title: grubMenuEntry.FindStringSubmatch(line)[1]}
+		case entry != nil && line == "}":
+			c.Entries = append(c.Entries, *entry)
+			entry = nil
+		case entry != nil:
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && (fields[0] == "linux" || fields[0] == "linuxefi") {
+				entry.Kernel = fields[1]
+				entry.Args = fields[2:]
+			}
+		}
+	}
+	return c
+}
+
+// DefaultEntry returns the entry booted by default, which is the first
+// one unless default names another one (by title or index).
+func (c *GrubConfig) DefaultEntry() *GrubEntry {
+	if len(c.Entries) == 0 {
+		return nil
+	}
+	for i, e := range c.Entries {
+		if e.Title == c.Default || strings.TrimSpace(c.Default) == strconv.Itoa(i) {
+			return &c.Entries[i]
+		}
+	}
+	return &c.Entries[0]
+}
+
+// EditGrubKernelArgs applies the edit to the kernel command line of every
+// menu entry and returns the config. Everything else, including the
+// indentation of the linux lines, is kept as is.
+func EditGrubKernelArgs(cfg []byte, edit *kernel.Edit) []byte {
+	lines := strings.SplitAfter(string(cfg), "\n")
+	inEntry := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inEntry && grubMenuEntry.MatchString(trimmed):
+			inEntry = true
+		case inEntry && trimmed == "}":
+			inEntry = false
+		case inEntry:
+			fields := strings.Fields(trimmed)
+			if len(fields) < 2 || (fields[0] != "linux" && fields[0] != "linuxefi") {
+				continue
+			}
+			indent := line[:strings.Index(line, fields[0])]
+			args := edit.Apply(kernel.Cmdline(fields[2:]))
+			edited := indent + strings.Join(append(fields[:2:2], args...), " ")
+			if strings.HasSuffix(line, "\n") {
+				edited += "\n"
+			}
+			lines[i] = edited
+		}
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// Version returns the first Talos version (like v1.11.3) in s, or an
+// empty string.
+func Version(s string) string {
+	return talosVersion.FindString(s)
+}
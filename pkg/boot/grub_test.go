@@ -0,0 +1,93 @@
+package boot_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/boot"
+	"github.com/fabiant7t/totalos/pkg/kernel"
+)
+
+const grubCfg = `set default="A - v1.11.3"
+
+set timeout=3
+
+insmod all_video
+
+terminal_input console
+terminal_output console
+
+menuentry "A - v1.11.3" {
+  set gfxmode=auto
+  set gfxpayload=text
+  linux /A/vmlinuz talos.platform=metal talos.config=https://example.com/config.yaml console=tty0 init_on_alloc=1
+  initrd /A/initramfs.xz
+}
+menuentry "Reset Talos installation and return to maintenance mode" {
+  set gfxmode=auto
+  set gfxpayload=text
+  linux /A/vmlinuz talos.platform=metal console=tty0 talos.experimental.wipe=system:EPHEMERAL,STATE
+  initrd /A/initramfs.xz
+}
+`
+
+func TestParseGrubConfig(t *testing.T) {
+	c := boot.ParseGrubConfig([]byte(grubCfg))
+	if len(c.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(c.Entries))
+	}
+	e := c.DefaultEntry()
+	if e.Title != "A - v1.11.3" || e.Kernel != "/A/vmlinuz" {
+		t.Errorf("got default entry %+v", e)
+	}
+	wantArgs := []string{"talos.platform=metal", "talos.config=https://example.com/config.yaml", "console=tty0", "init_on_alloc=1"}
+	if !slices.Equal(e.Args, wantArgs) {
+		t.Errorf("got args %q, want %q", e.Args, wantArgs)
+	}
+	if v := boot.Version(e.Title); v != "v1.11.3" {
+		t.Errorf("got version %q, want v1.11.3", v)
+	}
+}
+
+func TestDefaultEntryByIndex(t *testing.T) {
+	c := boot.ParseGrubConfig([]byte("set default=1\nmenuentry 'one' {\n}\nmenuentry 'two' {\n}\n"))
+	if e := c.DefaultEntry(); e == nil || e.Title != "two" {
+		t.Errorf("got default entry %+v, want two", e)
+	}
+	if e := boot.ParseGrubConfig(nil).DefaultEntry(); e != nil {
+		t.Errorf("got default entry %+v of an empty config", e)
+	}
+}
+
+func TestEditGrubKernelArgs(t *testing.T) {
+	edit := &kernel.Edit{
+		Set:    []string{"talos.config=https://example.com/other.yaml", "talos.dashboard.disabled=1"},
+		Remove: []string{"init_on_alloc"},
+	}
+	once := boot.EditGrubKernelArgs([]byte(grubCfg), edit)
+	if twice := boot.EditGrubKernelArgs(once, edit); string(twice) != string(once) {
+		t.Errorf("editing twice changed the config:\n%s", twice)
+	}
+	c := boot.ParseGrubConfig(once)
+	if len(c.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(c.Entries))
+	}
+	for i, want := range [][]string{
+		{"talos.platform=metal", "talos.config=https://example.com/other.yaml", "console=tty0", "talos.dashboard.disabled=1"},
+		{"talos.platform=metal", "console=tty0", "talos.experimental.wipe=system:EPHEMERAL,STATE", "talos.config=https://example.com/other.yaml", "talos.dashboard.disabled=1"},
+	} {
+		if got := c.Entries[i].Args; !slices.Equal(got, want) {
+			t.Errorf("entry %d: got args %q, want %q", i, got, want)
+		}
+	}
+	want := strings.Replace(grubCfg,
+		"linux /A/vmlinuz talos.platform=metal talos.config=https://example.com/config.yaml console=tty0 init_on_alloc=1",
+		"linux /A/vmlinuz talos.platform=metal talos.config=https://example.com/other.yaml console=tty0 talos.dashboard.disabled=1", 1)
+	want = strings.Replace(want,
+		"talos.experimental.wipe=system:EPHEMERAL,STATE\n",
+		"talos.experimental.wipe=system:EPHEMERAL,STATE talos.config=https://example.com/other.yaml talos.dashboard.disabled=1\n", 1)
+	if string(once) != want {
+		t.Errorf("got\n%s\nwant\n%s", once, want)
+	}
+}
@@ -0,0 +1,127 @@
+package boot
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"debug/pe"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Section locates a PE section in the file of a unified kernel image.
+type Section struct {
+	Offset int64
+	Size   int64
+}
+
+// UKISections parses the PE headers of a unified kernel image (UKI) and
+// returns its sections by name, like .osrel and .cmdline. head has to
+// hold the headers only, which fit into the leading few KiB.
+func UKISections(head []byte) (map[string]Section, error) {
+	f, err := pe.NewFile(bytes.NewReader(head))
+	if err != nil {
+		return nil, fmt.Errorf("parsing PE headers: %w", err)
+	}
+	defer f.Close()
+	sections := make(map[string]Section)
+	for _, s := range f.Sections {
+		size := s.VirtualSize
+		if size == 0 || size > s.Size {
+			// The raw data is padded to the file alignment
+			size = s.Size
+		}
+		sections[s.Name] = Section{Offset: int64(s.Offset), Size: int64(size)}
+	}
+	return sections, nil
+}
+
+// ParseOSRelease parses os-release(5) data, like the .osrel section of a
+// UKI.
+func ParseOSRelease(b []byte) map[string]string {
+	m := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(bytes.TrimRight(b, "\x00")))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		m[key] = strings.Trim(value, `"'`)
+	}
+	return m
+}
+
+// ParseCmdline splits the .cmdline section of a UKI into arguments.
+func ParseCmdline(b []byte) []string {
+	return strings.Fields(string(bytes.TrimRight(b, "\x00")))
+}
+
+// LoaderDefault returns the default entry of a systemd-boot loader.conf,
+// which may be a glob like Talos-*.efi.
+func LoaderDefault(loaderConf []byte) string {
+	s := bufio.NewScanner(bytes.NewReader(loaderConf))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[0] == "default" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// CompareUKIs orders the file names of UKIs by the Talos version they
+// carry, comparing the numbers (v1.11.10 comes after v1.11.9) and a
+// pre-release before its release. Names without a version come first.
+func CompareUKIs(a, b string) int {
+	va, preA, okA := parseVersion(Version(a))
+	vb, preB, okB := parseVersion(Version(b))
+	if c := cmp.Compare(boolInt(okA), boolInt(okB)); c != 0 {
+		return c
+	}
+	for i := range va {
+		if c := cmp.Compare(va[i], vb[i]); c != 0 {
+			return c
+		}
+	}
+	if (preA == "") != (preB == "") {
+		if preA == "" {
+			return 1
+		}
+		return -1
+	}
+	if c := strings.Compare(preA, preB); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// parseVersion splits a Talos version like v1.12.0-beta.0 into its
+// major, minor and patch numbers and the pre-release.
+func parseVersion(v string) ([3]int, string, bool) {
+	var nums [3]int
+	core, pre, _ := strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != len(nums) {
+		return nums, "", false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nums, "", false
+		}
+		nums[i] = n
+	}
+	return nums, pre, true
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
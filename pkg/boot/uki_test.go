@@ -0,0 +1,101 @@
+package boot_test
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/boot"
+)
+
+// uki builds a minimal PE file holding the sections.
+func uki(t *testing.T, sections map[string][]byte) []byte {
+	t.Helper()
+	names := []string{".osrel", ".cmdline", ".linux"}
+	const peOffset = 0x40
+	var b bytes.Buffer
+	dos := make([]byte, peOffset)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], peOffset)
+	b.Write(dos)
+	b.WriteString("PE\x00\x00")
+	binary.Write(&b, binary.LittleEndian, pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_AMD64, NumberOfSections: uint16(len(names))})
+	offset := uint32(peOffset + 4 + 20 + 40*len(names))
+	var data bytes.Buffer
+	for _, name := range names {
+		var h pe.SectionHeader32
+		copy(h.Name[:], name)
+		content := sections[name]
+		padded := append(content, make([]byte, 16-len(content)%16)...)
+		h.VirtualSize = uint32(len(content))
+		h.SizeOfRawData = uint32(len(padded))
+		h.PointerToRawData = offset + uint32(data.Len())
+		binary.Write(&b, binary.LittleEndian, h)
+		data.Write(padded)
+	}
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func TestUKISections(t *testing.T) {
+	osrel := []byte("NAME=\"Talos\"\nID=talos\nVERSION_ID=v1.11.3\nPRETTY_NAME=\"Talos (v1.11.3)\"\n")
+	cmdline := []byte("talos.platform=metal console=ttyS0 init_on_alloc=1\x00")
+	file := uki(t, map[string][]byte{".osrel": osrel, ".cmdline": cmdline, ".linux": []byte("kernel")})
+
+	// The headers are enough to locate the sections
+	sections, err := boot.UKISections(file[:0x40+4+20+3*40])
+	if err != nil {
+		t.Fatal(err)
+	}
+	section := func(name string) []byte {
+		s, ok := sections[name]
+		if !ok {
+			t.Fatalf("no section %s", name)
+		}
+		return file[s.Offset : s.Offset+s.Size]
+	}
+	if v := boot.ParseOSRelease(section(".osrel"))["VERSION_ID"]; v != "v1.11.3" {
+		t.Errorf("got VERSION_ID %q, want v1.11.3", v)
+	}
+	if v := boot.ParseOSRelease(section(".osrel"))["PRETTY_NAME"]; v != "Talos (v1.11.3)" {
+		t.Errorf("got PRETTY_NAME %q", v)
+	}
+	want := []string{"talos.platform=metal", "console=ttyS0", "init_on_alloc=1"}
+	if got := boot.ParseCmdline(section(".cmdline")); !slices.Equal(got, want) {
+		t.Errorf("got cmdline %q, want %q", got, want)
+	}
+	if _, err := boot.UKISections([]byte("not a PE file")); err == nil {
+		t.Error("got no error parsing garbage")
+	}
+}
+
+func TestLoaderDefault(t *testing.T) {
+	if got := boot.LoaderDefault([]byte("timeout 3\ndefault Talos-v1.11.3.efi\n")); got != "Talos-v1.11.3.efi" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCompareUKIs(t *testing.T) {
+	names := []string{
+		"Talos-v1.11.10.efi",
+		"Talos-v1.12.0.efi",
+		"Talos-v1.11.9.efi",
+		"Talos-v1.12.0-beta.0.efi",
+		"Talos-v1.9.5.efi",
+		"linux.efi",
+	}
+	slices.SortFunc(names, boot.CompareUKIs)
+	want := []string{
+		"linux.efi",
+		"Talos-v1.9.5.efi",
+		"Talos-v1.11.9.efi",
+		"Talos-v1.11.10.efi",
+		"Talos-v1.12.0-beta.0.efi",
+		"Talos-v1.12.0.efi",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+}
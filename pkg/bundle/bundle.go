@@ -0,0 +1,374 @@
+package bundle
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+const (
+	manifestName  = "manifest.json"
+	signatureName = "manifest.json.sig"
+)
+
+// Manifest lists the content of a bundle. It is signed, and since it
+// holds the SHA-256 of every file, so is the whole bundle.
+type Manifest struct {
+	Created time.Time `json:"created"`
+	Images  []Image   `json:"images"`
+	Configs []Config  `json:"configs"`
+}
+
+// Image of a bundle, stored at Path.
+type Image struct {
+	Arch    string `json:"arch"`
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+}
+
+// Config is a machine configuration, stored at Path.
+type Config struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Release names the image of an architecture and version (empty means
+// the latest release) that should become part of a bundle.
+type Release struct {
+	Arch    string
+	Version string
+}
+
+// Args of Create, all optional.
+type Args struct {
+	Client     *http.Client
+	Preference *image.Preference
+	// Configs maps the names of machine configurations to local files.
+	Configs map[string]string
+}
+
+// Create resolves the images of the releases through pkg/image,
+// downloads them and writes the signed bundle (a tarball) to w.
+func Create(ctx context.Context, w io.Writer, key ed25519.PrivateKey, releases []Release, args *Args) (*Manifest, error) {
+	if args == nil {
+		args = &Args{}
+	}
+	client := args.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	tmp, err := os.MkdirTemp("", "totalos-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	manifest := &Manifest{Created: time.Now().UTC()}
+	files := make(map[string]string) // path in bundle -> local file
+	for i, r := range releases {
+		imageURL, err := image.ReleaseImageURL(ctx, r.Arch, r.Version, client, args.Preference)
+		if err != nil {
+			return nil, err
+		}
+		local := path.Join(tmp, fmt.Sprintf("image-%d", i))
+		size, sum, err := download(ctx, client, imageURL, local)
+		if err != nil {
+			return nil, err
+		}
+		version := r.Version
+		if version == "" {
+			version = releaseVersion(imageURL)
+		}
+		img := Image{
+			Arch:    canonicalArch(r.Arch),
+			Version: version,
+			URL:     imageURL,
+			Path:    path.Join("images", fmt.Sprintf("%d-%s", i, imageName(imageURL))),
+			Size:    size,
+			SHA256:  sum,
+		}
+		manifest.Images = append(manifest.Images, img)
+		files[img.Path] = local
+	}
+	for name, local := range args.Configs {
+		size, sum, err := hashFile(local)
+		if err != nil {
+			return nil, err
+		}
+		cfg := Config{
+			Name:   name,
+			Path:   path.Join("configs", name+".yaml"),
+			Size:   size,
+			SHA256: sum,
+		}
+		manifest.Configs = append(manifest.Configs, cfg)
+		files[cfg.Path] = local
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(w)
+	// The manifest and its signature come first, so that a bundle can be
+	// verified before reading any further.
+	if err := writeTarFile(tw, manifestName, b); err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, signatureName, ed25519.Sign(key, b)); err != nil {
+		return nil, err
+	}
+	for _, img := range manifest.Images {
+		if err := copyTarFile(tw, img.Path, files[img.Path], img.Size); err != nil {
+			return nil, err
+		}
+	}
+	for _, cfg := range manifest.Configs {
+		if err := copyTarFile(tw, cfg.Path, files[cfg.Path], cfg.Size); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, tw.Close()
+}
+
+// Bundle is a bundle whose manifest signature has been verified.
+type Bundle struct {
+	path     string
+	Manifest Manifest
+}
+
+// Open reads the manifest of the bundle file and verifies its signature.
+func Open(name string, pub ed25519.PublicKey) (*Bundle, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	manifest, err := readTarFile(tr, manifestName)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := readTarFile(tr, signatureName)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(pub, manifest, sig) {
+		return nil, errors.New("bundle signature is invalid")
+	}
+	b := &Bundle{path: name}
+	if err := json.Unmarshal(manifest, &b.Manifest); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Image returns the image for the machine hardware name (`uname -m`).
+// When the bundle holds several versions, version picks one of them.
+func (b *Bundle) Image(machineHardwareName, version string) (*Image, error) {
+	var found []Image
+	for _, img := range b.Manifest.Images {
+		if img.Arch == canonicalArch(machineHardwareName) && (version == "" || img.Version == version) {
+			found = append(found, img)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("bundle holds no image for %s %s", machineHardwareName, version)
+	case 1:
+		return &found[0], nil
+	default:
+		return nil, fmt.Errorf("bundle holds %d images for %s, pick a version", len(found), machineHardwareName)
+	}
+}
+
+// Open returns the content of the file at path in the bundle. Reading
+// it to the end fails if it does not match the manifest's SHA-256.
+func (b *Bundle) Open(path string) (io.ReadCloser, error) {
+	var want string
+	for _, img := range b.Manifest.Images {
+		if img.Path == path {
+			want = img.SHA256
+		}
+	}
+	for _, cfg := range b.Manifest.Configs {
+		if cfg.Path == path {
+			want = cfg.SHA256
+		}
+	}
+	if want == "" {
+		return nil, fmt.Errorf("bundle manifest lists no %s", path)
+	}
+	f, err := os.Open(b.path)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			f.Close()
+			if err == io.EOF {
+				return nil, fmt.Errorf("bundle holds no %s", path)
+			}
+			return nil, err
+		}
+		if hdr.Name == path {
+			return &verifyingReader{r: tr, c: f, h: sha256.New(), want: want, name: path}, nil
+		}
+	}
+}
+
+// verifyingReader hashes what is being read and compares it with the
+// expected SHA-256 at EOF.
+type verifyingReader struct {
+	r    io.Reader
+	c    io.Closer
+	h    hash.Hash
+	want string
+	name string
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.h.Write(p[:n])
+	if err == io.EOF {
+		if got := hex.EncodeToString(v.h.Sum(nil)); got != v.want {
+			return n, fmt.Errorf("sha256 of %s is %s, want %s", v.name, got, v.want)
+		}
+	}
+	return n, err
+}
+
+func (v *verifyingReader) Close() error {
+	return v.c.Close()
+}
+
+func download(ctx context.Context, client *http.Client, imageURL, name string) (int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("downloading %s: %s", imageURL, res.Status)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), res.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), f.Close()
+}
+
+func hashFile(name string) (int64, string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// canonicalArch maps both names of 64-bit ARM to the one `uname -m`
+// reports on Linux.
+func canonicalArch(machineHardwareName string) string {
+	if machineHardwareName == "arm64" {
+		return "aarch64"
+	}
+	return machineHardwareName
+}
+
+// releaseVersion returns the release tag of a GitHub release download
+// URL (.../releases/download/<tag>/<asset>), also when it is being
+// served through an image cache.
+func releaseVersion(imageURL string) string {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return ""
+	}
+	if upstream := u.Query().Get("url"); upstream != "" {
+		return releaseVersion(upstream)
+	}
+	parts := strings.Split(u.Path, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "download" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+func imageName(imageURL string) string {
+	u, err := url.Parse(imageURL)
+	if err != nil || path.Base(u.Path) == "/" || path.Base(u.Path) == "." {
+		return "image"
+	}
+	return path.Base(u.Path)
+}
+
+func writeTarFile(tw *tar.Writer, name string, b []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(b))}); err != nil {
+		return err
+	}
+	_, err := tw.Write(b)
+	return err
+}
+
+func copyTarFile(tw *tar.Writer, name, local string, size int64) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func readTarFile(tr *tar.Reader, name string) ([]byte, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s of bundle: %w", name, err)
+	}
+	if hdr.Name != name {
+		return nil, fmt.Errorf("bundle starts with %s, want %s", hdr.Name, name)
+	}
+	return io.ReadAll(io.LimitReader(tr, 1<<20))
+}
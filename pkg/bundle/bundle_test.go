@@ -0,0 +1,147 @@
+package bundle_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/bundle"
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+func TestCreateAndOpen(t *testing.T) {
+	releases := `[
+	  {"tag_name": "v1.11.3", "assets": [
+	    {"name": "metal-amd64.raw.zst", "browser_download_url": "https://github.com/siderolabs/talos/releases/download/v1.11.3/metal-amd64.raw.zst"},
+	    {"name": "metal-arm64.raw.zst", "browser_download_url": "https://github.com/siderolabs/talos/releases/download/v1.11.3/metal-arm64.raw.zst"}
+	  ]}
+	]`
+	cache := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/releases":
+			io.WriteString(w, releases)
+		case strings.HasPrefix(r.URL.Path, "/fetch/"):
+			io.WriteString(w, "image "+r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer cache.Close()
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "worker.yaml")
+	if err := os.WriteFile(config, []byte("machine:\n  type: worker\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "bundle.tar")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bundle.Create(
+		context.Background(),
+		f,
+		priv,
+		[]bundle.Release{{Arch: "x86_64"}, {Arch: "arm64", Version: "v1.11.3"}},
+		&bundle.Args{
+			Preference: &image.Preference{CacheEndpoint: cache.URL},
+			Configs:    map[string]string{"worker": config},
+		},
+	)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bundle.Open(name, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := b.Image("aarch64", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Version != "v1.11.3" {
+		t.Errorf("got version %q, want v1.11.3", img.Version)
+	}
+	img, err = b.Image("x86_64", "v1.11.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := b.Open(img.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "image /fetch/metal-amd64.raw.zst"; string(got) != want {
+		t.Errorf("got image %q, want %q", got, want)
+	}
+	if len(b.Manifest.Configs) != 1 || b.Manifest.Configs[0].Name != "worker" {
+		t.Errorf("got configs %+v, want worker", b.Manifest.Configs)
+	}
+
+	// A foreign key must not verify the bundle
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bundle.Open(name, otherPub); err == nil {
+		t.Error("got no error opening the bundle with a foreign key")
+	}
+
+	// Tampering with an image must fail reading it
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(raw, []byte("image /fetch/metal-amd64"), []byte("IMAGE /fetch/metal-amd64"), 1)
+	if err := os.WriteFile(name, tampered, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rc, err = b.Open(img.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); err == nil {
+		t.Error("got no error reading a tampered image")
+	}
+}
+
+func TestKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	keyPath, pubPath := filepath.Join(dir, "bundle.key"), filepath.Join(dir, "bundle.pub")
+	if err := bundle.WriteKeyPair(keyPath, pubPath); err != nil {
+		t.Fatal(err)
+	}
+	priv, err := bundle.ReadPrivateKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := bundle.ReadPublicKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !priv.Public().(ed25519.PublicKey).Equal(pub) {
+		t.Error("public key does not belong to the private key")
+	}
+	if _, err := bundle.ReadPublicKey(keyPath); err == nil {
+		t.Error("got no error reading a private key as public key")
+	}
+}
@@ -0,0 +1,80 @@
+package event
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bar renders phases and a progress bar for humans watching a terminal.
+type Bar struct {
+	mu     sync.Mutex
+	w      io.Writer
+	meter  meter
+	active bool // a progress line needs to be terminated
+}
+
+func NewBar(w io.Writer) *Bar {
+	return &Bar{w: w}
+}
+
+func (b *Bar) Phase(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.endLine()
+	fmt.Fprintf(b.w, "==> %s\n", name)
+}
+
+func (b *Bar) Progress(downloaded, written, total int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rate, eta := b.meter.update(downloaded, total, time.Now())
+	b.active = true
+	if total <= 0 {
+		fmt.Fprintf(b.w, "\r%s downloaded, %s written, %s/s\033[K", size(downloaded), size(written), size(int64(rate)))
+		return
+	}
+	const width = 30
+	done := min(int(float64(width)*float64(downloaded)/float64(total)), width)
+	fmt.Fprintf(
+		b.w,
+		"\r[%s%s] %3d%% %s / %s, %s written, %s/s, ETA %s\033[K",
+		strings.Repeat("#", done),
+		strings.Repeat(".", width-done),
+		100*downloaded/total,
+		size(downloaded),
+		size(total),
+		size(written),
+		size(int64(rate)),
+		eta.Round(time.Second),
+	)
+}
+
+func (b *Bar) Done(any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.endLine()
+}
+
+func (b *Bar) endLine() {
+	if b.active {
+		fmt.Fprintln(b.w)
+		b.active = false
+	}
+}
+
+// size formats bytes in binary units
+func size(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
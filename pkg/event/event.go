@@ -0,0 +1,64 @@
+package event
+
+import (
+	"time"
+)
+
+// Emitter tells the operator, or the tooling wrapping totalos, what is
+// going on during an installation.
+type Emitter interface {
+	// Phase announces that the named phase of the installation begins.
+	Phase(name string)
+	// Progress reports the bytes of the image downloaded and written so
+	// far. Total is the size of the download, 0 if unknown.
+	Progress(downloaded, written, total int64)
+	// Done hands over the report of the installation.
+	Done(report any)
+}
+
+// Event is a single line of the NDJSON output.
+type Event struct {
+	Time            time.Time `json:"time"`
+	Type            string    `json:"type"`
+	Phase           string    `json:"phase,omitempty"`
+	DownloadedBytes int64     `json:"downloaded_bytes,omitempty"`
+	WrittenBytes    int64     `json:"written_bytes,omitempty"`
+	TotalBytes      int64     `json:"total_bytes,omitempty"`
+	BytesPerSecond  float64   `json:"bytes_per_second,omitempty"`
+	ETASeconds      float64   `json:"eta_seconds,omitempty"`
+	Report          any       `json:"report,omitempty"`
+}
+
+// Nop discards all events.
+type Nop struct{}
+
+func (Nop) Phase(string)                 {}
+func (Nop) Progress(int64, int64, int64) {}
+func (Nop) Done(any)                     {}
+
+// meter derives the throughput and the remaining time of a download
+// from the progress samples.
+type meter struct {
+	lastBytes int64
+	lastTime  time.Time
+	rate      float64
+}
+
+// update takes the bytes downloaded so far out of total and returns the
+// bytes per second and the estimated time to completion (0 if unknown).
+func (m *meter) update(bytes, total int64, now time.Time) (float64, time.Duration) {
+	if !m.lastTime.IsZero() && now.After(m.lastTime) && bytes >= m.lastBytes {
+		rate := float64(bytes-m.lastBytes) / now.Sub(m.lastTime).Seconds()
+		if m.rate == 0 {
+			m.rate = rate
+		} else { // smooth out bursts
+			m.rate = 0.7*m.rate + 0.3*rate
+		}
+	}
+	m.lastBytes, m.lastTime = bytes, now
+	var eta time.Duration
+	if total > bytes && m.rate > 0 {
+		eta = time.Duration(float64(total-bytes) / m.rate * float64(time.Second))
+	}
+	return m.rate, eta
+}
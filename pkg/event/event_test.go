@@ -0,0 +1,38 @@
+package event
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeter(t *testing.T) {
+	var m meter
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.update(0, 1000, start)
+	rate, eta := m.update(100, 1000, start.Add(time.Second))
+	if rate != 100 || eta != 9*time.Second {
+		t.Errorf("got %.1f B/s, ETA %s, want 100.0 B/s, ETA 9s", rate, eta)
+	}
+	if _, eta := m.update(1000, 0, start.Add(2*time.Second)); eta != 0 {
+		t.Errorf("got ETA %s without total, want 0s", eta)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	n := NewNDJSON(&buf)
+	n.now = func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }
+	n.Phase("install-image")
+	n.Progress(10, 20, 100)
+	n.Done(map[string]string{"image": "metal-amd64.raw.zst"})
+	want := strings.Join([]string{
+		`{"time":"2025-01-01T00:00:00Z","type":"phase","phase":"install-image"}`,
+		`{"time":"2025-01-01T00:00:00Z","type":"progress","downloaded_bytes":10,"written_bytes":20,"total_bytes":100}`,
+		`{"time":"2025-01-01T00:00:00Z","type":"report","report":{"image":"metal-amd64.raw.zst"}}`,
+	}, "\n") + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,49 @@
+package event
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// NDJSON writes every event as a line of JSON, for machines to read.
+type NDJSON struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	meter meter
+	now   func() time.Time
+}
+
+func NewNDJSON(w io.Writer) *NDJSON {
+	return &NDJSON{enc: json.NewEncoder(w), now: time.Now}
+}
+
+func (n *NDJSON) Phase(name string) {
+	n.emit(Event{Type: "phase", Phase: name})
+}
+
+func (n *NDJSON) Progress(downloaded, written, total int64) {
+	n.mu.Lock()
+	rate, eta := n.meter.update(downloaded, total, n.now())
+	n.mu.Unlock()
+	n.emit(Event{
+		Type:            "progress",
+		DownloadedBytes: downloaded,
+		WrittenBytes:    written,
+		TotalBytes:      total,
+		BytesPerSecond:  rate,
+		ETASeconds:      eta.Seconds(),
+	})
+}
+
+func (n *NDJSON) Done(report any) {
+	n.emit(Event{Type: "report", Report: report})
+}
+
+func (n *NDJSON) emit(e Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	e.Time = n.now().UTC()
+	n.enc.Encode(e)
+}
@@ -0,0 +1,105 @@
+// Package extension recommends Talos system extensions for the hardware
+// found by the inventory.
+package extension
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/server"
+)
+
+// Recommendation of a system extension, like siderolabs/amd-ucode.
+type Recommendation struct {
+	Extension string `json:"extension"`
+	// Reason names the hardware asking for the extension.
+	Reason string `json:"reason"`
+}
+
+// Rule maps hardware to a system extension. A rule matches the CPU by
+// vendor, or PCI devices by the driver the rescue system bound or by
+// vendor (and class prefix and device IDs, if given).
+type Rule struct {
+	Extension   string
+	Description string
+	// CPUVendor is contained in the CPU name, like AMD or Intel.
+	CPUVendor string
+	Drivers   []string
+	PCIVendor string
+	PCIClass  string
+	// PCIDevices restricts the rule to these device IDs of the vendor.
+	PCIDevices []string
+}
+
+// Rules of Recommend.
+var Rules = []Rule{
+	{Extension: "siderolabs/amd-ucode", Description: "AMD CPU", CPUVendor: "AMD"},
+	{Extension: "siderolabs/intel-ucode", Description: "Intel CPU", CPUVendor: "Intel"},
+	{
+		Extension: "siderolabs/bnx2-bnx2x", Description: "Broadcom NetXtreme II NIC",
+		Drivers: []string{"bnx2", "bnx2x"}, PCIVendor: "14e4", PCIClass: "02",
+		PCIDevices: []string{
+			"164a", "164c", "16aa", "16ac", "1639", "163a", "163b", "163c", // bnx2
+			"164e", "164f", "1650", "1662", "1663", "168a", "168d", "168e", // bnx2x
+			"16a1", "16a2", "16a4", "16a5", "16ab", "16ad", "16ae", "16af",
+		},
+	},
+	{Extension: "siderolabs/intel-ice-firmware", Description: "Intel E800 series NIC", Drivers: []string{"ice"}},
+	{Extension: "siderolabs/realtek-firmware", Description: "Realtek NIC", Drivers: []string{"r8169"}, PCIVendor: "10ec", PCIClass: "02"},
+	{Extension: "siderolabs/qlogic-firmware", Description: "QLogic HBA or NIC", Drivers: []string{"qla2xxx", "qed", "qede", "qedf", "qedi"}, PCIVendor: "1077"},
+	{Extension: "siderolabs/chelsio-firmware", Description: "Chelsio NIC", Drivers: []string{"cxgb4"}, PCIVendor: "1425", PCIClass: "02"},
+	{Extension: "siderolabs/nvidia-open-gpu-kernel-modules-production", Description: "NVIDIA GPU", PCIVendor: "10de", PCIClass: "03"},
+	{Extension: "siderolabs/nvidia-container-toolkit-production", Description: "NVIDIA GPU", PCIVendor: "10de", PCIClass: "03"},
+	{Extension: "siderolabs/amdgpu", Description: "AMD GPU", Drivers: []string{"amdgpu"}, PCIVendor: "1002", PCIClass: "03"},
+	{Extension: "siderolabs/i915", Description: "Intel GPU", Drivers: []string{"i915"}, PCIVendor: "8086", PCIClass: "03"},
+}
+
+// Recommend returns the extensions the rules recommend for the machine,
+// once each, in the order of the rules.
+func Recommend(mach *server.Machine, rules []Rule) []Recommendation {
+	var recs []Recommendation
+	seen := make(map[string]bool)
+	for _, r := range rules {
+		if seen[r.Extension] {
+			continue
+		}
+		if reason := r.match(mach); reason != "" {
+			recs = append(recs, Recommendation{Extension: r.Extension, Reason: reason})
+			seen[r.Extension] = true
+		}
+	}
+	return recs
+}
+
+// Extensions returns the names of the recommended extensions.
+func Extensions(recs []Recommendation) []string {
+	names := make([]string, len(recs))
+	for i, rec := range recs {
+		names[i] = rec.Extension
+	}
+	return names
+}
+
+// match returns why the rule matches the machine, empty if it does not.
+func (r *Rule) match(mach *server.Machine) string {
+	if r.CPUVendor != "" && strings.Contains(strings.ToLower(mach.CPU.Name), strings.ToLower(r.CPUVendor)) {
+		return fmt.Sprintf("%s (%s)", r.Description, mach.CPU.Name)
+	}
+	for _, d := range mach.PCIDevices {
+		if r.matchPCI(&d) {
+			return fmt.Sprintf("%s at %s (%s:%s)", r.Description, d.Slot, d.Vendor, d.Device)
+		}
+	}
+	return ""
+}
+
+func (r *Rule) matchPCI(d *server.PCIDevice) bool {
+	if d.Driver != "" && slices.Contains(r.Drivers, d.Driver) {
+		return true
+	}
+	if r.PCIVendor == "" || !strings.EqualFold(d.Vendor, r.PCIVendor) || !strings.HasPrefix(d.Class, r.PCIClass) {
+		return false
+	}
+	return len(r.PCIDevices) == 0 || slices.Contains(r.PCIDevices, strings.ToLower(d.Device))
+}
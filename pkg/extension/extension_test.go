@@ -0,0 +1,55 @@
+package extension_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/extension"
+	"github.com/fabiant7t/totalos/pkg/server"
+)
+
+func TestRecommend(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mach *server.Machine
+		want []string
+	}{
+		{
+			"amd with broadcom nic",
+			&server.Machine{
+				CPU: server.CPU{Name: "AMD EPYC 7502P 32-Core Processor"},
+				PCIDevices: []server.PCIDevice{
+					{Slot: "0000:01:00.0", Vendor: "14e4", Device: "164f", Class: "020000"},
+					{Slot: "0000:01:00.1", Vendor: "14e4", Device: "164f", Class: "020000"},
+				},
+			},
+			[]string{"siderolabs/amd-ucode", "siderolabs/bnx2-bnx2x"},
+		},
+		{
+			"intel with tg3 nic and nvidia gpu",
+			&server.Machine{
+				CPU: server.CPU{Name: "Intel(R) Xeon(R) E-2276G CPU @ 3.80GHz"},
+				PCIDevices: []server.PCIDevice{
+					{Slot: "0000:02:00.0", Vendor: "14e4", Device: "165f", Class: "020000", Driver: "tg3"},
+					{Slot: "0000:03:00.0", Vendor: "10de", Device: "2236", Class: "030200"},
+				},
+			},
+			[]string{"siderolabs/intel-ucode", "siderolabs/nvidia-open-gpu-kernel-modules-production", "siderolabs/nvidia-container-toolkit-production"},
+		},
+		{
+			"matched by driver",
+			&server.Machine{PCIDevices: []server.PCIDevice{{Slot: "0000:04:00.0", Vendor: "8086", Device: "159b", Class: "020000", Driver: "ice"}}},
+			[]string{"siderolabs/intel-ice-firmware"},
+		},
+		{"arm64 without devices", &server.Machine{CPU: server.CPU{Name: "Neoverse-N1"}}, nil},
+	} {
+		got := extension.Extensions(extension.Recommend(tc.mach, extension.Rules))
+		if !slices.Equal(got, tc.want) && (len(got) != 0 || len(tc.want) != 0) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+	recs := extension.Recommend(&server.Machine{PCIDevices: []server.PCIDevice{{Slot: "0000:01:00.0", Vendor: "14e4", Device: "164f", Class: "020000"}}}, extension.Rules)
+	if want := "Broadcom NetXtreme II NIC at 0000:01:00.0 (14e4:164f)"; len(recs) != 1 || recs[0].Reason != want {
+		t.Errorf("got %+v, want reason %q", recs, want)
+	}
+}
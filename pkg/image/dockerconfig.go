@@ -0,0 +1,113 @@
+package image
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DockerConfig holds the registry credentials of a docker config.json,
+// as written by `docker login`.
+type DockerConfig struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+	// CredsStore and CredHelpers name docker-credential-* helpers.
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// LoadDockerConfig reads the docker config at path. An empty path means
+// config.json in $DOCKER_CONFIG or ~/.docker. A missing file yields an
+// empty config (anonymous access).
+func LoadDockerConfig(path string) (*DockerConfig, error) {
+	if path == "" {
+		dir := os.Getenv("DOCKER_CONFIG")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return &DockerConfig{}, nil
+			}
+			dir = filepath.Join(home, ".docker")
+		}
+		path = filepath.Join(dir, "config.json")
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &DockerConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c DockerConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("parsing docker config %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Credentials implements Credentials. Credential helpers take precedence
+// over the auths of the config file, like they do for docker.
+func (c *DockerConfig) Credentials(registry string) (string, string, error) {
+	if helper := c.CredHelpers[registry]; helper != "" {
+		return credentialHelper(helper, registry)
+	}
+	if c.CredsStore != "" {
+		return credentialHelper(c.CredsStore, registry)
+	}
+	for key, a := range c.Auths {
+		if registryHost(key) != registry {
+			continue
+		}
+		if a.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("docker config auth of %s: %w", registry, err)
+			}
+			username, password, _ := strings.Cut(string(decoded), ":")
+			return username, password, nil
+		}
+		return a.Username, a.Password, nil
+	}
+	return "", "", nil
+}
+
+// registryHost strips scheme and path of an auths key, which docker
+// writes as https://index.docker.io/v1/ for instance.
+func registryHost(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ := strings.Cut(key, "/")
+	return host
+}
+
+// credentialHelper asks docker-credential-<helper> for the credentials.
+func credentialHelper(helper, registry string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(msg, "credentials not found") {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("docker-credential-%s: %w: %s", helper, err, msg)
+	}
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return "", "", fmt.Errorf("docker-credential-%s: %w", helper, err)
+	}
+	return creds.Username, creds.Secret, nil
+}
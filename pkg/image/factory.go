@@ -0,0 +1,122 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// FactoryURL is the Talos Image Factory building images from schematics.
+const FactoryURL = "https://factory.talos.dev"
+
+// Schematic describes the customization of an Image Factory image.
+type Schematic struct {
+	Overlay       *Overlay       `json:"overlay,omitempty"`
+	Customization *Customization `json:"customization,omitempty"`
+}
+
+// Customization of a schematic.
+type Customization struct {
+	ExtraKernelArgs  []string          `json:"extraKernelArgs,omitempty"`
+	SystemExtensions *SystemExtensions `json:"systemExtensions,omitempty"`
+}
+
+// SystemExtensions of a schematic.
+type SystemExtensions struct {
+	// OfficialExtensions are named like siderolabs/intel-ucode.
+	OfficialExtensions []string `json:"officialExtensions,omitempty"`
+}
+
+// SchematicID uploads the schematic to the Image Factory and returns its
+// ID. The factory takes YAML, which JSON is a subset of.
+func SchematicID(ctx context.Context, schematic *Schematic, client *http.Client, pref *Preference) (string, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	body, err := json.Marshal(schematic)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, factoryURL(pref)+"/schematics", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("Image Factory refused schematic: %s: %s", res.Status, bytes.TrimSpace(b))
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(b, &created); err != nil {
+		return "", err
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("Image Factory returned no schematic ID")
+	}
+	return created.ID, nil
+}
+
+// FactoryImageURL returns the URL of the image (like metal-arm64.raw.xz)
+// the Image Factory builds for the schematic and Talos version. If the
+// preference names a cache endpoint, the image is being served by it.
+func FactoryImageURL(schematicID, version, name string, pref *Preference) string {
+	u := fmt.Sprintf("%s/image/%s/%s/%s", factoryURL(pref), schematicID, version, name)
+	if pref != nil && pref.CacheEndpoint != "" {
+		return CacheURL(pref.CacheEndpoint, u)
+	}
+	return u
+}
+
+// SchematicOf returns the schematic ID of an Image Factory image URL
+// (also when served by a cache), empty for other images.
+func SchematicOf(imageURL string) string {
+	if unescaped, err := url.QueryUnescape(imageURL); err == nil {
+		imageURL = unescaped
+	}
+	if m := factoryImagePath.FindStringSubmatch(imageURL); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+var factoryImagePath = regexp.MustCompile(`/image/([0-9a-f]{64})/v[0-9]`)
+
+// FactoryVariant returns the Image Factory URL of the image built for the
+// schematic, which has the Talos version and file name of the given
+// Talos release or Image Factory image (also when served by a cache).
+// It is false for other images.
+func FactoryVariant(imageURL, schematicID string, pref *Preference) (string, bool) {
+	if unescaped, err := url.QueryUnescape(imageURL); err == nil {
+		imageURL = unescaped
+	}
+	m := releaseImagePath.FindStringSubmatch(imageURL)
+	if m == nil {
+		return "", false
+	}
+	return FactoryImageURL(schematicID, m[1], m[2], pref), true
+}
+
+var releaseImagePath = regexp.MustCompile(`(?:github\.com/siderolabs/talos/releases/download|/image/[0-9a-f]{64})/(v[0-9][^/]*)/([^/?#&]+)$`)
+
+func factoryURL(pref *Preference) string {
+	if pref != nil && pref.FactoryEndpoint != "" {
+		return strings.TrimSuffix(pref.FactoryEndpoint, "/")
+	}
+	return FactoryURL
+}
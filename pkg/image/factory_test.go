@@ -0,0 +1,54 @@
+package image_test
+
+import (
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+func TestSchematicOf(t *testing.T) {
+	const id = "376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba"
+	for _, tc := range []struct {
+		url  string
+		want string
+	}{
+		{"https://factory.talos.dev/image/" + id + "/v1.11.3/metal-amd64.raw.xz", id},
+		{image.CacheURL("http://cache:8080", "https://factory.talos.dev/image/"+id+"/v1.11.3/metal-amd64.raw.xz"), id},
+		{"https://github.com/siderolabs/talos/releases/download/v1.11.3/metal-amd64.raw.zst", ""},
+	} {
+		if got := image.SchematicOf(tc.url); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestFactoryVariant(t *testing.T) {
+	const id = "376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba"
+	const custom = "ee21ef4a5ef808a9b7484cc0dda0f25075021691c8c09a276591eedb638ea1f9"
+	for _, tc := range []struct {
+		url    string
+		pref   *image.Preference
+		want   string
+		wantOK bool
+	}{
+		{
+			"https://github.com/siderolabs/talos/releases/download/v1.11.3/metal-amd64.raw.zst", nil,
+			"https://factory.talos.dev/image/" + custom + "/v1.11.3/metal-amd64.raw.zst", true,
+		},
+		{
+			"https://factory.talos.dev/image/" + id + "/v1.11.3/metal-amd64-secureboot.raw.xz", nil,
+			"https://factory.talos.dev/image/" + custom + "/v1.11.3/metal-amd64-secureboot.raw.xz", true,
+		},
+		{
+			image.CacheURL("http://cache:8080", "https://github.com/siderolabs/talos/releases/download/v1.11.3/metal-arm64.raw.zst"),
+			&image.Preference{CacheEndpoint: "http://cache:8080"},
+			image.CacheURL("http://cache:8080", "https://factory.talos.dev/image/"+custom+"/v1.11.3/metal-arm64.raw.zst"), true,
+		},
+		{"https://example.com/talos/v1.11.3/metal-amd64.raw.zst", nil, "", false},
+	} {
+		got, ok := image.FactoryVariant(tc.url, custom, tc.pref)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("%s: got %q, %t, want %q, %t", tc.url, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Format of an image as it is being downloaded.
+type Format string
+
+const (
+	FormatRaw   Format = "raw"
+	FormatISO   Format = "iso"
+	FormatXZ    Format = "xz"
+	FormatZstd  Format = "zstd"
+	FormatGzip  Format = "gzip"
+	FormatBzip2 Format = "bzip2"
+	FormatLZ4   Format = "lz4"
+)
+
+// SniffLength is the number of leading bytes DetectFormat needs to
+// recognise every format. The ISO9660 primary volume descriptor starts
+// after 32 KiB of system area.
+const SniffLength = isoMagicOffset + 5
+
+const isoMagicOffset = 0x8001
+
+var magics = []struct {
+	format Format
+	magic  []byte
+}{
+	{FormatXZ, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{FormatZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{FormatGzip, []byte{0x1f, 0x8b}},
+	{FormatBzip2, []byte{'B', 'Z', 'h'}},
+	{FormatLZ4, []byte{0x04, 0x22, 0x4d, 0x18}},
+}
+
+var contentTypes = map[string]Format{
+	"application/x-xz":             FormatXZ,
+	"application/zstd":             FormatZstd,
+	"application/x-zstd":           FormatZstd,
+	"application/gzip":             FormatGzip,
+	"application/x-gzip":           FormatGzip,
+	"application/x-bzip2":          FormatBzip2,
+	"application/x-lz4":            FormatLZ4,
+	"application/x-iso9660-image":  FormatISO,
+	"application/x-raw-disk-image": FormatRaw,
+}
+
+var extensions = map[string]Format{
+	".xz":  FormatXZ,
+	".zst": FormatZstd,
+	".gz":  FormatGzip,
+	".bz2": FormatBzip2,
+	".lz4": FormatLZ4,
+	".iso": FormatISO,
+	".raw": FormatRaw,
+	".img": FormatRaw,
+}
+
+// DetectFormat tells the image format from the leading bytes of the
+// download (see SniffLength). The Content-Type header and the file
+// extension of the URL are only consulted when the content is not
+// conclusive.
+func DetectFormat(head []byte, contentType, imageURL string) (Format, error) {
+	for _, m := range magics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.format, nil
+		}
+	}
+	if len(head) >= SniffLength && string(head[isoMagicOffset:SniffLength]) == "CD001" {
+		return FormatISO, nil
+	}
+	// Protective MBR or GPT header of a plain disk image
+	if len(head) >= 520 && (string(head[512:520]) == "EFI PART" || (head[510] == 0x55 && head[511] == 0xaa)) {
+		return FormatRaw, nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if f, ok := contentTypes[mediaType]; ok {
+			return f, nil
+		}
+	}
+	if u, err := url.Parse(imageURL); err == nil {
+		if f, ok := extensions[strings.ToLower(path.Ext(u.Path))]; ok {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("cannot detect image format of %s (content type %q)", imageURL, contentType)
+}
+
+// CheckArch returns an error when the image URL names an architecture
+// that differs from the machine hardware name (`uname -m`). URLs which
+// do not name any architecture pass.
+func CheckArch(imageURL, machineHardwareName string) error {
+	imageArch := nameArch(imageURL)
+	if imageArch == "" {
+		return nil
+	}
+	machineArch, err := goArch(machineHardwareName)
+	if err != nil {
+		return err
+	}
+	if imageArch != machineArch {
+		return fmt.Errorf("image %s is built for %s, but the machine is %s", imageURL, imageArch, machineHardwareName)
+	}
+	return nil
+}
+
+// nameArch returns the architecture (amd64 or arm64) a URL or file name
+// mentions, or an empty string.
+func nameArch(name string) string {
+	s := name
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		s = unescaped
+	}
+	s = strings.ToLower(s)
+	switch {
+	case strings.Contains(s, "amd64") || strings.Contains(s, "x86_64"):
+		return "amd64"
+	case strings.Contains(s, "arm64") || strings.Contains(s, "aarch64"):
+		return "arm64"
+	default:
+		return ""
+	}
+}
+
+// goArch maps the machine hardware name to the architecture name of Go,
+// which Talos and OCI platforms use as well.
+func goArch(machineHardwareName string) (string, error) {
+	switch machineHardwareName {
+	case "x86_64":
+		return "amd64", nil
+	case "aarch64", "arm64":
+		return "arm64", nil
+	default:
+		return "", fmt.Errorf("Unknown machine hardware name (architecture: %s)", machineHardwareName)
+	}
+}
@@ -0,0 +1,61 @@
+package image_test
+
+import (
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+func TestDetectFormat(t *testing.T) {
+	iso := make([]byte, image.SniffLength)
+	copy(iso[0x8001:], "CD001")
+	gpt := make([]byte, 1024)
+	copy(gpt[512:], "EFI PART")
+
+	for _, tc := range []struct {
+		name        string
+		head        []byte
+		contentType string
+		url         string
+		want        image.Format
+	}{
+		{"xz magic", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, "", "https://example.com/image", image.FormatXZ},
+		{"zstd magic wins over extension", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}, "", "https://example.com/metal.raw.xz", image.FormatZstd},
+		{"gzip magic", []byte{0x1f, 0x8b, 0x08}, "", "", image.FormatGzip},
+		{"bzip2 magic", []byte("BZh91AY"), "", "", image.FormatBzip2},
+		{"lz4 magic", []byte{0x04, 0x22, 0x4d, 0x18, 0x64}, "", "", image.FormatLZ4},
+		{"iso9660", iso, "", "", image.FormatISO},
+		{"raw gpt", gpt, "", "", image.FormatRaw},
+		{"content type", []byte("unknown"), "application/x-xz; charset=binary", "", image.FormatXZ},
+		{"extension of presigned url", []byte("unknown"), "application/octet-stream", "https://s3.example.com/metal-amd64.raw.zst?X-Amz-Signature=abc", image.FormatZstd},
+	} {
+		got, err := image.DetectFormat(tc.head, tc.contentType, tc.url)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := image.DetectFormat([]byte("unknown"), "application/octet-stream", "https://example.com/image"); err == nil {
+		t.Error("got no error for unknown format")
+	}
+}
+
+func TestCheckArch(t *testing.T) {
+	for _, tc := range []struct {
+		url     string
+		arch    string
+		wantErr bool
+	}{
+		{"https://example.com/metal-amd64.raw.zst", "x86_64", false},
+		{"https://example.com/metal-arm64.raw.zst", "aarch64", false},
+		{"https://example.com/metal-arm64.raw.zst", "x86_64", true},
+		{"http://cache:8080/fetch/image?url=https%3A%2F%2Fexample.com%2Fmetal-amd64.raw.xz", "aarch64", true},
+		{"https://example.com/talos.raw", "x86_64", false},
+	} {
+		if err := image.CheckArch(tc.url, tc.arch); (err != nil) != tc.wantErr {
+			t.Errorf("%s on %s: got error %v, want error %t", tc.url, tc.arch, err, tc.wantErr)
+		}
+	}
+}
@@ -7,8 +7,27 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"path"
+	"strings"
 )
 
+// ReleasesURL is the GitHub API endpoint listing the Talos releases.
+const ReleasesURL = "https://api.github.com/repos/siderolabs/talos/releases?per_page=100"
+
+// Preference adjusts how images are being looked up.
+type Preference struct {
+	// CacheEndpoint is the base URL of a `totalos serve-images` instance.
+	// When set, releases are looked up and downloaded through it.
+	CacheEndpoint string
+	// FactoryEndpoint replaces FactoryURL, like for a self-hosted Image
+	// Factory.
+	FactoryEndpoint string
+	// Credentials authenticate at OCI registries, nil means anonymous
+	// access.
+	Credentials Credentials
+}
+
 type githubRelease struct {
 	Name       string        `json:"name"`
 	TagName    string        `json:"tag_name"`
@@ -22,17 +41,39 @@ type githubAsset struct {
 	ContentType        string `json:"content_type"`
 	Size               int    `json:"size"`
 	BrowserDownloadURL string `json:"browser_download_url"`
+	// Digest is like sha256:<hex>, GitHub computes it for new uploads.
+	Digest string `json:"digest"`
 }
 
 // LatestImageURL takes the machine hardware name (architecture, the
 // result of `uname -m`), reads the GitHub releases API and returns
 // the latest non-draft and non-prerelease metal ISO URL.
-func LatestImageURL(ctx context.Context, machineHardwareName string, client *http.Client) (string, error) {
+// If the preference names a cache endpoint, both the releases and the
+// image are being served by the cache.
+func LatestImageURL(ctx context.Context, machineHardwareName string, client *http.Client, pref *Preference) (string, error) {
+	return ReleaseImageURL(ctx, machineHardwareName, "", client, pref)
+}
+
+// ReleaseImageURL works like LatestImageURL, but returns the image URL
+// of the release tagged with version (like v1.11.3). An empty version
+// means the latest release.
+func ReleaseImageURL(ctx context.Context, machineHardwareName, version string, client *http.Client, pref *Preference) (string, error) {
+	a, err := releaseImage(ctx, machineHardwareName, version, client, pref)
+	if err != nil {
+		return "", err
+	}
+	return a.BrowserDownloadURL, nil
+}
+
+// releaseImage returns the metal image asset of the release, its
+// download URL pointing to the cache endpoint of the preference if set.
+func releaseImage(ctx context.Context, machineHardwareName, version string, client *http.Client, pref *Preference) (*githubAsset, error) {
 	if client == nil {
 		client = &http.Client{}
 	}
-
-	url := "https://api.github.com/repos/siderolabs/talos/releases"
+	if pref == nil {
+		pref = &Preference{}
+	}
 
 	var wantName string
 	switch arch := machineHardwareName; arch {
@@ -41,36 +82,92 @@ func LatestImageURL(ctx context.Context, machineHardwareName string, client *htt
 	case "aarch64", "arm64":
 		wantName = "metal-arm64.raw.zst"
 	default:
-		return "", fmt.Errorf("Unknown machine hardware name (architecture: %s)", arch)
+		return nil, fmt.Errorf("Unknown machine hardware name (architecture: %s)", arch)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	rr, err := releases(ctx, client, pref)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rr {
+		if version != "" && r.TagName != version {
+			continue
+		}
+		if version == "" && (r.Draft || r.Prerelease) {
+			continue
+		}
+		for _, a := range r.Assets {
+			if a.Name == wantName {
+				if pref.CacheEndpoint != "" {
+					a.BrowserDownloadURL = CacheURL(pref.CacheEndpoint, a.BrowserDownloadURL)
+				}
+				return &a, nil
+			}
+		}
+	}
+	if version != "" {
+		return nil, fmt.Errorf("Cannot find %s in release %s", wantName, version)
+	}
+	return nil, errors.New("Cannot parse latest ISO")
+}
+
+// LatestVersion returns the tag of the latest non-draft and
+// non-prerelease Talos release (like v1.11.3).
+func LatestVersion(ctx context.Context, client *http.Client, pref *Preference) (string, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	rr, err := releases(ctx, client, pref)
 	if err != nil {
 		return "", err
 	}
+	for _, r := range rr {
+		if !r.Draft && !r.Prerelease {
+			return r.TagName, nil
+		}
+	}
+	return "", errors.New("Cannot find latest release")
+}
+
+// releases reads the GitHub releases API, through the cache endpoint of
+// the preference if set.
+func releases(ctx context.Context, client *http.Client, pref *Preference) ([]githubRelease, error) {
+	releasesURL := ReleasesURL
+	if pref != nil && pref.CacheEndpoint != "" {
+		releasesURL = strings.TrimSuffix(pref.CacheEndpoint, "/") + "/releases"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releasesURL, nil)
+	if err != nil {
+		return nil, err
+	}
 	res, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer res.Body.Close()
 	b, err := io.ReadAll(res.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
 	var rr []githubRelease
 	if err := json.Unmarshal(b, &rr); err != nil {
-		return "", err
+		return nil, err
 	}
-	for _, r := range rr {
-		if r.Draft || r.Prerelease {
-			continue
-		}
-		for _, a := range r.Assets {
-			if a.Name == wantName {
-				return a.BrowserDownloadURL, nil
-			}
-		}
+	return rr, nil
+}
+
+// CacheURL returns the URL at which the cache endpoint serves the
+// upstream URL. The file name of the upstream URL is being kept, so
+// that the URL path still tells the image type.
+func CacheURL(cacheEndpoint, upstreamURL string) string {
+	name := "image"
+	if u, err := url.Parse(upstreamURL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
 	}
-	return "", errors.New("Cannot parse latest ISO")
+	return fmt.Sprintf(
+		"%s/fetch/%s?url=%s",
+		strings.TrimSuffix(cacheEndpoint, "/"),
+		url.PathEscape(name),
+		url.QueryEscape(upstreamURL),
+	)
 }
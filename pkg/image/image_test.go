@@ -0,0 +1,39 @@
+package image_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+func TestLatestImageURLThroughCache(t *testing.T) {
+	releases := `[
+	  {"tag_name": "v1.12.0-beta.0", "prerelease": true, "assets": [
+	    {"name": "metal-amd64.raw.zst", "browser_download_url": "https://github.com/siderolabs/talos/releases/download/v1.12.0-beta.0/metal-amd64.raw.zst"}
+	  ]},
+	  {"tag_name": "v1.11.3", "assets": [
+	    {"name": "metal-amd64.raw.zst", "browser_download_url": "https://github.com/siderolabs/talos/releases/download/v1.11.3/metal-amd64.raw.zst"}
+	  ]}
+	]`
+	cache := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, releases)
+	}))
+	defer cache.Close()
+
+	got, err := image.LatestImageURL(context.Background(), "x86_64", nil, &image.Preference{CacheEndpoint: cache.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cache.URL + "/fetch/metal-amd64.raw.zst?url=https%3A%2F%2Fgithub.com%2Fsiderolabs%2Ftalos%2Freleases%2Fdownload%2Fv1.11.3%2Fmetal-amd64.raw.zst"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,394 @@
+package image
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OCIScheme prefixes image references of disk images stored as OCI
+// artifacts in a container registry, like oci://harbor.example.com/talos/metal:v1.11.3.
+const OCIScheme = "oci://"
+
+// acceptManifests lists the manifest media types ResolveOCIImage reads.
+const acceptManifests = "application/vnd.oci.image.index.v1+json, " +
+	"application/vnd.oci.image.manifest.v1+json, " +
+	"application/vnd.docker.distribution.manifest.list.v2+json, " +
+	"application/vnd.docker.distribution.manifest.v2+json"
+
+const (
+	annotationTitle = "org.opencontainers.image.title"
+	maxManifestSize = 4 << 20
+)
+
+// Credentials look up the username and password for a registry host.
+// Empty credentials mean anonymous access.
+type Credentials interface {
+	Credentials(registry string) (username, password string, err error)
+}
+
+// OCIReference is a parsed oci:// image reference.
+type OCIReference struct {
+	Registry   string
+	Repository string
+	// Reference is a tag or a digest (sha256:...).
+	Reference string
+}
+
+// ParseOCIReference parses oci://registry/repository[:tag|@digest]. The
+// tag defaults to latest.
+func ParseOCIReference(s string) (*OCIReference, error) {
+	rest, ok := strings.CutPrefix(s, OCIScheme)
+	if !ok {
+		return nil, fmt.Errorf("image reference %s does not start with %s", s, OCIScheme)
+	}
+	registry, repo, ok := strings.Cut(rest, "/")
+	if !ok || registry == "" || repo == "" {
+		return nil, fmt.Errorf("image reference %s lacks registry or repository", s)
+	}
+	ref := &OCIReference{Registry: registry, Repository: repo, Reference: "latest"}
+	if name, digest, ok := strings.Cut(repo, "@"); ok {
+		ref.Repository, ref.Reference = name, digest
+	} else if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		ref.Repository, ref.Reference = repo[:i], repo[i+1:]
+	}
+	if ref.Repository == "" || ref.Reference == "" {
+		return nil, fmt.Errorf("image reference %s is incomplete", s)
+	}
+	return ref, nil
+}
+
+func (r *OCIReference) String() string {
+	sep := ":"
+	if strings.Contains(r.Reference, ":") {
+		sep = "@"
+	}
+	return OCIScheme + r.Registry + "/" + r.Repository + sep + r.Reference
+}
+
+// OCIBlob is the layer of an OCI artifact holding the disk image.
+type OCIBlob struct {
+	// URL the blob is downloaded from, either the registry or the
+	// storage it redirects to.
+	URL string
+	// Headers needed to download URL, like Authorization.
+	Headers []string
+	// Digest of the blob, like sha256:...
+	Digest string
+	Size   int64
+	// Title is the file name the blob has been pushed with (if any).
+	Title string
+}
+
+// SHA256 returns the hex encoded SHA-256 of a sha256 digest, otherwise
+// an empty string.
+func (b *OCIBlob) SHA256() string {
+	if sum, ok := strings.CutPrefix(b.Digest, "sha256:"); ok {
+		return sum
+	}
+	return ""
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// ResolveOCIImage resolves the reference (oci://...) to the blob holding
+// the disk image for the machine hardware name (`uname -m`). Image
+// indexes are resolved by platform, artifacts with several layers by the
+// architecture their titles name. Registries are authenticated at with
+// the credentials of the preference, if any.
+func ResolveOCIImage(ctx context.Context, reference, machineHardwareName string, client *http.Client, pref *Preference) (*OCIBlob, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	if pref == nil {
+		pref = &Preference{}
+	}
+	arch, err := goArch(machineHardwareName)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := ParseOCIReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	r := &ociRegistry{client: client, ref: ref, creds: pref.Credentials}
+
+	manifest, err := r.manifest(ctx, ref.Reference)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Manifests) > 0 {
+		var digest string
+		for _, m := range manifest.Manifests {
+			if m.Platform != nil && m.Platform.Architecture == arch && (m.Platform.OS == "" || m.Platform.OS == "linux") {
+				digest = m.Digest
+				break
+			}
+		}
+		if digest == "" {
+			return nil, fmt.Errorf("image index %s holds no manifest for linux/%s", ref, arch)
+		}
+		if manifest, err = r.manifest(ctx, digest); err != nil {
+			return nil, err
+		}
+	}
+
+	layer, err := pickLayer(manifest.Layers, arch)
+	if err != nil {
+		return nil, fmt.Errorf("image %s: %w", ref, err)
+	}
+	blob := &OCIBlob{
+		Digest: layer.Digest,
+		Size:   layer.Size,
+		Title:  layer.Annotations[annotationTitle],
+	}
+	if err := r.locateBlob(ctx, blob); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// pickLayer returns the layer whose title names the architecture, or
+// the only layer if it names none.
+func pickLayer(layers []ociDescriptor, arch string) (*ociDescriptor, error) {
+	var found []*ociDescriptor
+	for i, l := range layers {
+		if nameArch(l.Annotations[annotationTitle]) == arch {
+			found = append(found, &layers[i])
+		}
+	}
+	switch {
+	case len(found) == 1:
+		return found[0], nil
+	case len(found) > 1:
+		return nil, fmt.Errorf("%d layers are built for %s", len(found), arch)
+	case len(layers) == 1 && nameArch(layers[0].Annotations[annotationTitle]) == "":
+		return &layers[0], nil
+	default:
+		return nil, fmt.Errorf("no layer is built for %s", arch)
+	}
+}
+
+// ociRegistry speaks the OCI distribution API with a single repository.
+type ociRegistry struct {
+	client        *http.Client
+	ref           *OCIReference
+	creds         Credentials
+	authorization string
+}
+
+func (r *ociRegistry) url(kind, reference string) string {
+	scheme := "https"
+	// Like docker, registries on the loopback interface speak plain HTTP
+	host, _, err := net.SplitHostPort(r.ref.Registry)
+	if err != nil {
+		host = r.ref.Registry
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s/%s", scheme, r.ref.Registry, r.ref.Repository, kind, reference)
+}
+
+func (r *ociRegistry) manifest(ctx context.Context, reference string) (*ociManifest, error) {
+	res, err := r.do(ctx, r.client, http.MethodGet, r.url("manifests", reference), acceptManifests)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("manifest %s of %s: %s", reference, r.ref, res.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxManifestSize))
+	if err != nil {
+		return nil, err
+	}
+	var m ociManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("manifest %s of %s: %w", reference, r.ref, err)
+	}
+	return &m, nil
+}
+
+// locateBlob sets the URL of the blob. Registries backed by object
+// storage redirect to a pre-signed URL, which must be downloaded from
+// without the registry's Authorization header.
+func (r *ociRegistry) locateBlob(ctx context.Context, blob *OCIBlob) error {
+	noRedirect := *r.client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	blobURL := r.url("blobs", blob.Digest)
+	res, err := r.do(ctx, &noRedirect, http.MethodHead, blobURL, "")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusOK:
+		blob.URL = blobURL
+		if r.authorization != "" {
+			blob.Headers = []string{"Authorization: " + r.authorization}
+		}
+		return nil
+	case res.StatusCode >= 300 && res.StatusCode < 400:
+		loc, err := res.Location()
+		if err != nil {
+			return fmt.Errorf("blob %s of %s: %w", blob.Digest, r.ref, err)
+		}
+		blob.URL = loc.String()
+		return nil
+	default:
+		return fmt.Errorf("blob %s of %s: %s", blob.Digest, r.ref, res.Status)
+	}
+}
+
+// do sends the request, authenticating once the registry asks for it.
+func (r *ociRegistry) do(ctx context.Context, client *http.Client, method, url, accept string) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if r.authorization != "" {
+			req.Header.Set("Authorization", r.authorization)
+		}
+		return client.Do(req)
+	}
+	res, err := send()
+	if err != nil || res.StatusCode != http.StatusUnauthorized || r.authorization != "" {
+		return res, err
+	}
+	res.Body.Close()
+	if err := r.authenticate(ctx, res.Header.Get("WWW-Authenticate")); err != nil {
+		return nil, fmt.Errorf("authenticating at %s: %w", r.ref.Registry, err)
+	}
+	return send()
+}
+
+// authenticate answers a Basic or Bearer (token) challenge.
+func (r *ociRegistry) authenticate(ctx context.Context, challenge string) error {
+	var username, password string
+	if r.creds != nil {
+		var err error
+		if username, password, err = r.creds.Credentials(r.ref.Registry); err != nil {
+			return err
+		}
+	}
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return errors.New("registry requires credentials")
+		}
+		r.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+		return nil
+	case "bearer":
+		token, err := r.token(ctx, params, username, password)
+		if err != nil {
+			return err
+		}
+		r.authorization = "Bearer " + token
+		return nil
+	default:
+		return fmt.Errorf("unsupported challenge %q", challenge)
+	}
+}
+
+// token fetches a bearer token from the realm of the challenge.
+func (r *ociRegistry) token(ctx context.Context, params map[string]string, username, password string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	q := realm.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + r.ref.Repository + ":pull"
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request: %s", res.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxManifestSize)).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", errors.New("token response holds no token")
+}
+
+// parseChallenge parses a WWW-Authenticate header like
+// Bearer realm="https://auth.example.com/token",service="registry".
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key], rest = value[1:end+1], value[end+2:]
+		} else {
+			params[key], rest, _ = strings.Cut(value, ",")
+		}
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return scheme, params
+}
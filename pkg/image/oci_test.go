@@ -0,0 +1,227 @@
+package image_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+type staticCredentials struct{ username, password string }
+
+func (c staticCredentials) Credentials(string) (string, string, error) {
+	return c.username, c.password, nil
+}
+
+// testRegistry is an in-process registry with Harbor-like token auth.
+// Blobs named in redirect are served by a storage endpoint.
+type testRegistry struct {
+	*httptest.Server
+	manifests map[string]string // reference -> manifest
+	blobs     map[string]string // digest -> content
+	redirect  map[string]bool
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{manifests: map[string]string{}, blobs: map[string]string{}, redirect: map[string]bool{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/token":
+			if u, p, ok := req.BasicAuth(); !ok || u != "robot" || p != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if req.URL.Query().Get("scope") != "repository:talos/metal:pull" {
+				http.Error(w, "wrong scope", http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"token": "t0k"}`)
+		case strings.HasPrefix(req.URL.Path, "/storage/"):
+			fmt.Fprint(w, r.blobs[strings.TrimPrefix(req.URL.Path, "/storage/")])
+		case strings.HasPrefix(req.URL.Path, "/v2/talos/metal/"):
+			if req.Header.Get("Authorization") != "Bearer t0k" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="harbor-registry",scope="repository:talos/metal:pull"`, r.URL))
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			kind, ref, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/talos/metal/"), "/")
+			switch {
+			case kind == "manifests" && r.manifests[ref] != "":
+				fmt.Fprint(w, r.manifests[ref])
+			case kind == "blobs" && r.redirect[ref]:
+				http.Redirect(w, req, "/storage/"+ref, http.StatusTemporaryRedirect)
+			case kind == "blobs" && r.blobs[ref] != "":
+				fmt.Fprint(w, r.blobs[ref])
+			default:
+				http.NotFound(w, req)
+			}
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// blob stores the content and returns its descriptor.
+func (r *testRegistry) blob(title, content string) string {
+	sum := sha256.Sum256([]byte(content))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	r.blobs[digest] = content
+	return fmt.Sprintf(
+		`{"mediaType": "application/vnd.oci.image.layer.v1.tar", "digest": %q, "size": %d, "annotations": {"org.opencontainers.image.title": %q}}`,
+		digest, len(content), title,
+	)
+}
+
+// manifest stores the manifest under its digest and the tags.
+func (r *testRegistry) manifest(body string, tags ...string) string {
+	sum := sha256.Sum256([]byte(body))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	r.manifests[digest] = body
+	for _, tag := range tags {
+		r.manifests[tag] = body
+	}
+	return digest
+}
+
+func TestResolveOCIImage(t *testing.T) {
+	reg := newTestRegistry(t)
+	host := strings.TrimPrefix(reg.URL, "http://")
+	creds := &image.Preference{Credentials: staticCredentials{"robot", "secret"}}
+
+	// Image index with a manifest per platform
+	amd64 := reg.manifest(`{"mediaType": "application/vnd.oci.image.manifest.v1+json", "layers": [` + reg.blob("metal-amd64.raw.zst", "amd64 image") + `]}`)
+	arm64 := reg.manifest(`{"mediaType": "application/vnd.oci.image.manifest.v1+json", "layers": [` + reg.blob("metal-arm64.raw.zst", "arm64 image") + `]}`)
+	reg.manifest(fmt.Sprintf(`{"mediaType": "application/vnd.oci.image.index.v1+json", "manifests": [
+	  {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": %q, "platform": {"architecture": "amd64", "os": "linux"}},
+	  {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": %q, "platform": {"architecture": "arm64", "os": "linux"}}
+	]}`, amd64, arm64), "v1.11.3")
+	// Artifact holding the images of both architectures as layers
+	reg.manifest(`{"mediaType": "application/vnd.oci.image.manifest.v1+json", "layers": [`+
+		reg.blob("metal-amd64.raw.xz", "amd64 artifact")+", "+reg.blob("metal-arm64.raw.xz", "arm64 artifact")+`]}`, "artifact")
+	// Single layer stored in object storage
+	redirected := reg.blob("metal.raw", "redirected image")
+	var redirectedDesc struct{ Digest string }
+	json.Unmarshal([]byte(redirected), &redirectedDesc)
+	reg.redirect[redirectedDesc.Digest] = true
+	reg.manifest(`{"mediaType": "application/vnd.oci.image.manifest.v1+json", "layers": [`+redirected+`]}`, "redirected")
+
+	for _, tc := range []struct {
+		name        string
+		reference   string
+		arch        string
+		pref        *image.Preference
+		wantContent string
+		wantURL     string
+		wantHeaders []string
+		wantErr     bool
+	}{
+		{"index", "oci://" + host + "/talos/metal:v1.11.3", "aarch64", creds, "arm64 image", "", []string{"Authorization: Bearer t0k"}, false},
+		{"artifact layers", "oci://" + host + "/talos/metal:artifact", "x86_64", creds, "amd64 artifact", "", []string{"Authorization: Bearer t0k"}, false},
+		{"redirect to storage", "oci://" + host + "/talos/metal:redirected", "x86_64", creds, "redirected image", reg.URL + "/storage/" + redirectedDesc.Digest, nil, false},
+		{"by digest", "oci://" + host + "/talos/metal@" + amd64, "x86_64", creds, "amd64 image", "", []string{"Authorization: Bearer t0k"}, false},
+		{"wrong architecture", "oci://" + host + "/talos/metal@" + amd64, "aarch64", creds, "", "", nil, true},
+		{"anonymous", "oci://" + host + "/talos/metal:v1.11.3", "x86_64", nil, "", "", nil, true},
+		{"unknown tag", "oci://" + host + "/talos/metal:v0.0.0", "x86_64", creds, "", "", nil, true},
+	} {
+		blob, err := image.ResolveOCIImage(context.Background(), tc.reference, tc.arch, nil, tc.pref)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: got blob %+v, want error", tc.name, blob)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		sum := sha256.Sum256([]byte(tc.wantContent))
+		if blob.SHA256() != hex.EncodeToString(sum[:]) || blob.Size != int64(len(tc.wantContent)) {
+			t.Errorf("%s: got blob %s (%d bytes), want the one of %q", tc.name, blob.Digest, blob.Size, tc.wantContent)
+		}
+		wantURL := tc.wantURL
+		if wantURL == "" {
+			wantURL = reg.URL + "/v2/talos/metal/blobs/" + blob.Digest
+		}
+		if blob.URL != wantURL {
+			t.Errorf("%s: got URL %s, want %s", tc.name, blob.URL, wantURL)
+		}
+		if !slices.Equal(blob.Headers, tc.wantHeaders) {
+			t.Errorf("%s: got headers %q, want %q", tc.name, blob.Headers, tc.wantHeaders)
+		}
+	}
+}
+
+func TestParseOCIReference(t *testing.T) {
+	for _, tc := range []struct {
+		s       string
+		want    image.OCIReference
+		wantErr bool
+	}{
+		{"oci://harbor.example.com/talos/metal:v1.11.3", image.OCIReference{"harbor.example.com", "talos/metal", "v1.11.3"}, false},
+		{"oci://harbor.example.com:5000/talos/metal", image.OCIReference{"harbor.example.com:5000", "talos/metal", "latest"}, false},
+		{"oci://harbor.example.com/metal@sha256:abc", image.OCIReference{"harbor.example.com", "metal", "sha256:abc"}, false},
+		{"https://harbor.example.com/talos/metal", image.OCIReference{}, true},
+		{"oci://harbor.example.com", image.OCIReference{}, true},
+	} {
+		got, err := image.ParseOCIReference(tc.s)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %+v, want error", tc.s, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.s, err)
+			continue
+		}
+		if *got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.s, *got, tc.want)
+		}
+		if got.String() != tc.s && !strings.HasSuffix(tc.s, "/talos/metal") {
+			t.Errorf("%s: String() is %s", tc.s, got.String())
+		}
+	}
+}
+
+func TestDockerConfigCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"auths": {
+	  "https://harbor.example.com/v1/": {"auth": "cm9ib3Q6c2VjcmV0"},
+	  "registry.example.com": {"username": "admin", "password": "hunter2"}
+	}}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := image.LoadDockerConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ registry, username, password string }{
+		{"harbor.example.com", "robot", "secret"},
+		{"registry.example.com", "admin", "hunter2"},
+		{"unknown.example.com", "", ""},
+	} {
+		username, password, err := c.Credentials(tc.registry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username != tc.username || password != tc.password {
+			t.Errorf("%s: got %s:%s, want %s:%s", tc.registry, username, password, tc.username, tc.password)
+		}
+	}
+	if c, err := image.LoadDockerConfig(filepath.Join(t.TempDir(), "missing.json")); err != nil || len(c.Auths) != 0 {
+		t.Errorf("got %+v, %v for a missing config, want an empty one", c, err)
+	}
+}
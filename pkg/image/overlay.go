@@ -0,0 +1,114 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Overlay is a Talos board overlay, which single-board computers need
+// to boot (firmware, device trees, bootloader).
+type Overlay struct {
+	// Name of the board, like rpi_generic.
+	Name string `json:"name"`
+	// Image holding the overlay, like siderolabs/sbc-raspberrypi.
+	Image string `json:"image"`
+}
+
+// boardOverlays maps device tree compatible strings to overlays. An
+// entry ending with a comma matches every board of the vendor.
+var boardOverlays = []struct {
+	compatible string
+	overlay    Overlay
+}{
+	{"raspberrypi,", Overlay{"rpi_generic", "siderolabs/sbc-raspberrypi"}},
+	{"radxa,rock-5b", Overlay{"rock5b", "siderolabs/sbc-rockchip"}},
+	{"radxa,rock-4c-plus", Overlay{"rock4cplus", "siderolabs/sbc-rockchip"}},
+	{"radxa,rockpi4c", Overlay{"rockpi4c", "siderolabs/sbc-rockchip"}},
+	{"radxa,rockpi4a", Overlay{"rockpi4", "siderolabs/sbc-rockchip"}},
+	{"radxa,rockpi4b", Overlay{"rockpi4", "siderolabs/sbc-rockchip"}},
+	{"pine64,rock64", Overlay{"rock64", "siderolabs/sbc-rockchip"}},
+	{"friendlyarm,nanopi-r4s", Overlay{"nanopi-r4s", "siderolabs/sbc-rockchip"}},
+	{"friendlyelec,nanopi-r5s", Overlay{"nanopi-r5s", "siderolabs/sbc-rockchip"}},
+	{"xunlong,orangepi-5", Overlay{"orangepi-5", "siderolabs/sbc-rockchip"}},
+	{"turing,rk1", Overlay{"turingrk1", "siderolabs/sbc-rockchip"}},
+	{"kobol,helios64", Overlay{"helios64", "siderolabs/sbc-rockchip"}},
+	{"nvidia,p3450-0000", Overlay{"jetson_nano", "siderolabs/sbc-jetson"}},
+	{"sinovoip,bananapi-m64", Overlay{"bananapi_m64", "siderolabs/sbc-allwinner"}},
+	{"pine64,pine64", Overlay{"pine64", "siderolabs/sbc-allwinner"}},
+	{"libretech,all-h3-cc-h5", Overlay{"libretech_all_h3_cc_h5", "siderolabs/sbc-allwinner"}},
+}
+
+// BoardOverlay returns the overlay for the board described by the
+// device tree (/proc/device-tree/model and compatible), or nil for
+// boards booting the plain metal image (like servers with UEFI).
+func BoardOverlay(model string, compatible []string) *Overlay {
+	// compatible lists the most specific string first
+	for _, c := range compatible {
+		for _, b := range boardOverlays {
+			if c == b.compatible || (strings.HasSuffix(b.compatible, ",") && strings.HasPrefix(c, b.compatible)) {
+				overlay := b.overlay
+				return &overlay
+			}
+		}
+	}
+	if strings.HasPrefix(model, "Raspberry Pi") {
+		return &Overlay{"rpi_generic", "siderolabs/sbc-raspberrypi"}
+	}
+	return nil
+}
+
+// BoardOverlayByName returns the known overlay of that name.
+func BoardOverlayByName(name string) (*Overlay, error) {
+	for _, b := range boardOverlays {
+		if b.overlay.Name == name {
+			overlay := b.overlay
+			return &overlay, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown board overlay %s", name)
+}
+
+// BoardImageURL returns the arm64 image with the overlay for the Talos
+// release version (empty means the latest release). Releases which ship
+// board images as assets (metal-<board>-arm64.raw.xz) are served from
+// GitHub, other ones are built by the Image Factory.
+func BoardImageURL(ctx context.Context, overlay *Overlay, version string, client *http.Client, pref *Preference) (string, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	rr, err := releases(ctx, client, pref)
+	if err != nil {
+		return "", err
+	}
+	wantName := fmt.Sprintf("metal-%s-arm64.raw.xz", overlay.Name)
+	for _, r := range rr {
+		if version != "" && r.TagName != version {
+			continue
+		}
+		if version == "" && (r.Draft || r.Prerelease) {
+			continue
+		}
+		for _, a := range r.Assets {
+			if a.Name == wantName {
+				if pref != nil && pref.CacheEndpoint != "" {
+					return CacheURL(pref.CacheEndpoint, a.BrowserDownloadURL), nil
+				}
+				return a.BrowserDownloadURL, nil
+			}
+		}
+		if version == "" {
+			version = r.TagName
+		}
+		break
+	}
+	if version == "" {
+		return "", fmt.Errorf("Cannot find latest release")
+	}
+	id, err := SchematicID(ctx, &Schematic{Overlay: overlay}, client, pref)
+	if err != nil {
+		return "", err
+	}
+	return FactoryImageURL(id, version, "metal-arm64.raw.xz", pref), nil
+}
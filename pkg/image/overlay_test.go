@@ -0,0 +1,90 @@
+package image_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+func TestBoardOverlay(t *testing.T) {
+	for _, tc := range []struct {
+		model      string
+		compatible []string
+		want       string
+	}{
+		{"Raspberry Pi 4 Model B Rev 1.5", []string{"raspberrypi,4-model-b", "brcm,bcm2711"}, "rpi_generic"},
+		{"Raspberry Pi Compute Module 4", nil, "rpi_generic"},
+		{"Radxa ROCK 5B", []string{"radxa,rock-5b", "rockchip,rk3588"}, "rock5b"},
+		{"NVIDIA Jetson Nano Developer Kit", []string{"nvidia,p3450-0000", "nvidia,jetson-nano", "nvidia,tegra210"}, "jetson_nano"},
+		{"", nil, ""},
+		{"QEMU KVM Virtual Machine", []string{"linux,dummy-virt"}, ""},
+	} {
+		got := image.BoardOverlay(tc.model, tc.compatible)
+		if (got == nil && tc.want != "") || (got != nil && got.Name != tc.want) {
+			t.Errorf("%s: got %+v, want %q", tc.model, got, tc.want)
+		}
+	}
+	if _, err := image.BoardOverlayByName("rock5b"); err != nil {
+		t.Error(err)
+	}
+	if _, err := image.BoardOverlayByName("toaster"); err == nil {
+		t.Error("got no error for an unknown overlay")
+	}
+}
+
+func TestBoardImageURL(t *testing.T) {
+	releases := `[
+	  {"tag_name": "v1.11.3", "assets": [
+	    {"name": "metal-arm64.raw.zst", "browser_download_url": "https://github.com/siderolabs/talos/releases/download/v1.11.3/metal-arm64.raw.zst"}
+	  ]},
+	  {"tag_name": "v1.5.5", "assets": [
+	    {"name": "metal-rpi_generic-arm64.raw.xz", "browser_download_url": "https://github.com/siderolabs/talos/releases/download/v1.5.5/metal-rpi_generic-arm64.raw.xz"}
+	  ]}
+	]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/releases":
+			io.WriteString(w, releases)
+		case r.Method == http.MethodPost && r.URL.Path == "/schematics":
+			var s image.Schematic
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s.Overlay == nil || s.Overlay.Name != "rpi_generic" || s.Overlay.Image != "siderolabs/sbc-raspberrypi" {
+				http.Error(w, "bad schematic", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "ee21ef4a5ef808a9b7484cc0dda0f25075021691c8c09a276591eedb638ea1f9"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	pref := &image.Preference{CacheEndpoint: srv.URL, FactoryEndpoint: srv.URL}
+	overlay, err := image.BoardOverlayByName("rpi_generic")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := image.BoardImageURL(context.Background(), overlay, "", nil, pref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := image.CacheURL(srv.URL, srv.URL+"/image/ee21ef4a5ef808a9b7484cc0dda0f25075021691c8c09a276591eedb638ea1f9/v1.11.3/metal-arm64.raw.xz")
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// Old releases ship board images as assets
+	got, err = image.BoardImageURL(context.Background(), overlay, "v1.5.5", nil, pref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = image.CacheURL(srv.URL, "https://github.com/siderolabs/talos/releases/download/v1.5.5/metal-rpi_generic-arm64.raw.xz")
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,187 @@
+package image
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Scheme prefixes images in S3-compatible buckets, like
+// s3://bucket/talos/metal-amd64.raw.zst.
+const S3Scheme = "s3://"
+
+// S3Source serves an image of an S3-compatible bucket by a presigned URL,
+// so that the rescue system downloads it without credentials.
+type S3Source struct {
+	Bucket string
+	Key    string
+	// Endpoint is the base URL of S3-compatible storage (like MinIO),
+	// addressing buckets by path. Empty means AWS, addressing buckets by
+	// virtual host.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expires is how long the presigned URL is valid, it has to outlast
+	// the download including its retries. Defaults to 6 hours.
+	Expires time.Duration
+	Client  *http.Client
+}
+
+// NewS3Source takes an s3://bucket/key URL.
+func NewS3Source(imageURL string) (*S3Source, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(imageURL, S3Scheme), "/")
+	if !strings.HasPrefix(imageURL, S3Scheme) || bucket == "" || key == "" {
+		return nil, fmt.Errorf("Invalid S3 URL %s, want s3://bucket/key", imageURL)
+	}
+	return &S3Source{Bucket: bucket, Key: key}, nil
+}
+
+// Resolve checks that the object exists and takes its size, and its
+// SHA-256 from the user metadata sha256 if set.
+func (s *S3Source) Resolve(ctx context.Context, machineHardwareName, version string) (*Artifact, error) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	now := time.Now()
+	headURL, err := s.Presign(http.MethodHead, now)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, headURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Cannot access %s%s/%s: %s", S3Scheme, s.Bucket, s.Key, res.Status)
+	}
+	getURL, err := s.Presign(http.MethodGet, now)
+	if err != nil {
+		return nil, err
+	}
+	a := &Artifact{
+		URL:       getURL,
+		Size:      max(res.ContentLength, 0),
+		Reference: S3Scheme + s.Bucket + "/" + s.Key,
+	}
+	if sha := strings.ToLower(res.Header.Get("X-Amz-Meta-Sha256")); len(sha) == 64 {
+		if _, err := hex.DecodeString(sha); err == nil {
+			a.SHA256 = sha
+		}
+	}
+	return a, nil
+}
+
+// Presign returns the URL of the object, signed by AWS Signature Version
+// 4 for the method (GET or HEAD) at time t.
+func (s *S3Source) Presign(method string, t time.Time) (string, error) {
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	expires := s.Expires
+	if expires == 0 {
+		expires = 6 * time.Hour
+	}
+	var u *url.URL
+	if s.Endpoint != "" {
+		var err error
+		if u, err = url.Parse(strings.TrimSuffix(s.Endpoint, "/")); err != nil {
+			return "", err
+		}
+		u.Path += "/" + s.Bucket + "/" + s.Key
+	} else {
+		host := "s3." + region + ".amazonaws.com"
+		if region == "us-east-1" {
+			host = "s3.amazonaws.com"
+		}
+		u = &url.URL{Scheme: "https", Host: s.Bucket + "." + host, Path: "/" + s.Key}
+	}
+
+	t = t.UTC()
+	date := t.Format("20060102")
+	scope := date + "/" + region + "/s3/aws4_request"
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    s.AccessKeyID + "/" + scope,
+		"X-Amz-Date":          t.Format("20060102T150405Z"),
+		"X-Amz-Expires":       fmt.Sprint(int(expires.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	if s.SessionToken != "" {
+		query["X-Amz-Security-Token"] = s.SessionToken
+	}
+	canonicalPath := s3Escape(u.Path, false)
+	canonicalQuery := s3Query(query)
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalPath,
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		query["X-Amz-Date"],
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+	key := []byte("AWS4" + s.SecretAccessKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", u.Scheme, u.Host, canonicalPath, canonicalQuery, signature), nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Query returns the query sorted by key, the way SigV4 wants it.
+func s3Query(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = s3Escape(k, true) + "=" + s3Escape(query[k], true)
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes all but the unreserved characters of RFC 3986,
+// and slashes unless escaping a query component.
+func s3Escape(s string, component bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !component:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SecureBootImageURL returns the secureboot variant of the metal image
+// (metal-<arch>-secureboot.raw.xz) for the Talos release version (empty
+// means the latest release). It is signed with the Sidero Labs keys,
+// which the image enrolls on firmware in setup mode. Releases do not ship
+// it as an asset, the Image Factory builds it from the empty schematic.
+func SecureBootImageURL(ctx context.Context, machineHardwareName, version string, client *http.Client, pref *Preference) (string, error) {
+	arch, err := goArch(machineHardwareName)
+	if err != nil {
+		return "", err
+	}
+	if client == nil {
+		client = &http.Client{}
+	}
+	if version == "" {
+		if version, err = LatestVersion(ctx, client, pref); err != nil {
+			return "", err
+		}
+	}
+	id, err := SchematicID(ctx, &Schematic{}, client, pref)
+	if err != nil {
+		return "", err
+	}
+	return FactoryImageURL(id, version, fmt.Sprintf("metal-%s-secureboot.raw.xz", arch), pref), nil
+}
+
+// IsSecureBootImage tells whether the URL or file name names a Talos
+// secureboot image variant, like metal-amd64-secureboot.raw.xz.
+func IsSecureBootImage(name string) bool {
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		name = unescaped
+	}
+	return strings.Contains(strings.ToLower(name), "secureboot")
+}
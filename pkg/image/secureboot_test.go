@@ -0,0 +1,62 @@
+package image_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+func TestSecureBootImageURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/releases":
+			io.WriteString(w, `[{"tag_name": "v1.12.0-beta.0", "prerelease": true}, {"tag_name": "v1.11.3"}]`)
+		case r.Method == http.MethodPost && r.URL.Path == "/schematics":
+			if b, _ := io.ReadAll(r.Body); strings.TrimSpace(string(b)) != "{}" {
+				http.Error(w, "bad schematic", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	pref := &image.Preference{CacheEndpoint: srv.URL, FactoryEndpoint: srv.URL}
+
+	got, err := image.SecureBootImageURL(context.Background(), "x86_64", "", nil, pref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := image.CacheURL(srv.URL, srv.URL+"/image/376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba/v1.11.3/metal-amd64-secureboot.raw.xz")
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if !image.IsSecureBootImage(got) {
+		t.Errorf("%s is not being recognized as secureboot image", got)
+	}
+	if _, err := image.SecureBootImageURL(context.Background(), "riscv64", "v1.11.3", nil, pref); err == nil {
+		t.Error("got no error for an unknown architecture")
+	}
+}
+
+func TestIsSecureBootImage(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want bool
+	}{
+		{"https://factory.talos.dev/image/376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba/v1.11.3/metal-amd64-secureboot.raw.xz", true},
+		{"http://cache:8080/image?url=https%3A%2F%2Ffactory.talos.dev%2Fimage%2Fid%2Fv1.11.3%2Fmetal-amd64-secureboot.raw.xz", true},
+		{"https://github.com/siderolabs/talos/releases/download/v1.11.3/metal-amd64.raw.zst", false},
+	} {
+		if got := image.IsSecureBootImage(tc.name); got != tc.want {
+			t.Errorf("%s: got %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileScheme prefixes images on the local machine.
+const FileScheme = "file://"
+
+// ImageSource resolves the image to install on a machine.
+type ImageSource interface {
+	// Resolve returns the image for the machine hardware name (`uname -m`)
+	// and the Talos version, empty meaning the latest release. Sources
+	// naming a single image ignore both.
+	Resolve(ctx context.Context, machineHardwareName, version string) (*Artifact, error)
+}
+
+// Artifact is an image resolved by an ImageSource.
+type Artifact struct {
+	// URL the rescue system downloads the image from. Local images are
+	// streamed with Open instead, their URL is for reporting only.
+	URL string
+	// Headers of the download, like "Authorization: Bearer ...".
+	Headers []string
+	// Size of the download in bytes, 0 if unknown.
+	Size int64
+	// SHA256 of the download (hex), empty if unknown.
+	SHA256 string
+	// Reference names the image when it differs from URL, like an
+	// oci:// reference or s3:// URL.
+	Reference string
+	// Open streams a local image, nil for downloads.
+	Open func() (io.ReadCloser, error)
+}
+
+// GitHubSource serves the metal images of the Talos GitHub releases.
+type GitHubSource struct {
+	Client     *http.Client
+	Preference *Preference
+}
+
+func (s *GitHubSource) Resolve(ctx context.Context, machineHardwareName, version string) (*Artifact, error) {
+	a, err := releaseImage(ctx, machineHardwareName, version, s.Client, s.Preference)
+	if err != nil {
+		return nil, err
+	}
+	return &Artifact{
+		URL:    a.BrowserDownloadURL,
+		Size:   int64(a.Size),
+		SHA256: strings.TrimPrefix(a.Digest, "sha256:"),
+	}, nil
+}
+
+// FileSource serves an image file of the local machine, which is being
+// pushed to the rescue system over SSH.
+type FileSource struct {
+	Path string
+}
+
+// NewFileSource takes a file:// URL or a path.
+func NewFileSource(imageURL string) (*FileSource, error) {
+	p := strings.TrimPrefix(imageURL, FileScheme)
+	if p == "" {
+		return nil, errors.New("file:// image without path")
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSource{Path: abs}, nil
+}
+
+// Resolve reads the file once to compute its SHA-256, the rescue system
+// checks the pushed image against it.
+func (s *FileSource) Resolve(ctx context.Context, machineHardwareName, version string) (*Artifact, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return &Artifact{
+		URL:    FileScheme + s.Path,
+		Size:   n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(s.Path)
+		},
+	}, nil
+}
+
+// HTTPSource serves an image by HTTP(S). Credentials are passed to the
+// downloader on the rescue system as headers.
+type HTTPSource struct {
+	URL string
+	// Username and Password authenticate by HTTP basic auth.
+	Username string
+	Password string
+	// Headers like "Authorization: Bearer ...".
+	Headers []string
+	// Preference names the cache endpoint to download through, which
+	// does not take credentials.
+	Preference *Preference
+}
+
+// NewHTTPSource takes the user info of the URL as basic auth credentials.
+func NewHTTPSource(imageURL string, headers []string, pref *Preference) (*HTTPSource, error) {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%s is no HTTP(S) URL", imageURL)
+	}
+	s := &HTTPSource{Headers: headers, Preference: pref}
+	if u.User != nil {
+		s.Username = u.User.Username()
+		s.Password, _ = u.User.Password()
+		u.User = nil
+	}
+	s.URL = u.String()
+	return s, nil
+}
+
+func (s *HTTPSource) Resolve(ctx context.Context, machineHardwareName, version string) (*Artifact, error) {
+	a := &Artifact{URL: s.URL, Headers: s.Headers}
+	if s.Username != "" || s.Password != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(s.Username + ":" + s.Password))
+		a.Headers = append([]string{"Authorization: Basic " + auth}, a.Headers...)
+	}
+	if s.Preference != nil && s.Preference.CacheEndpoint != "" {
+		if len(a.Headers) > 0 {
+			return nil, errors.New("Authenticated images cannot be downloaded through the image cache")
+		}
+		a.URL = CacheURL(s.Preference.CacheEndpoint, s.URL)
+	}
+	return a, nil
+}
+
+// OCISource serves an image stored as OCI artifact in a registry.
+type OCISource struct {
+	Reference  string
+	Client     *http.Client
+	Preference *Preference
+}
+
+func (s *OCISource) Resolve(ctx context.Context, machineHardwareName, version string) (*Artifact, error) {
+	blob, err := ResolveOCIImage(ctx, s.Reference, machineHardwareName, s.Client, s.Preference)
+	if err != nil {
+		return nil, err
+	}
+	return &Artifact{
+		URL:       blob.URL,
+		Headers:   blob.Headers,
+		Size:      blob.Size,
+		SHA256:    blob.SHA256(),
+		Reference: s.Reference,
+	}, nil
+}
@@ -0,0 +1,318 @@
+package imagecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultAllowHosts are the upstream hosts images may be fetched from,
+// unless configured otherwise. Subdomains are allowed as well.
+var DefaultAllowHosts = []string{"github.com", "factory.talos.dev"}
+
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Cache is a http.Handler that fetches images from upstream on first
+// request, stores them content-addressed (by SHA-256) on disk and
+// serves them from there, including range requests.
+//
+// Routes:
+//
+//	GET /releases                       GitHub releases of Talos (cached for a while)
+//	GET /fetch/{name}?url={upstream}    redirects to the blob of the upstream URL
+//	GET /blobs/sha256/{digest}/{name}   serves the blob
+type Cache struct {
+	dir             string
+	client          *http.Client
+	allowHosts      []string
+	releasesURL     string
+	releasesTTL     time.Duration
+	releasesTimeout time.Duration
+	mux             *http.ServeMux
+	downloads       singleflight.Group
+	releasesFetch   singleflight.Group
+
+	mu         sync.Mutex
+	releases   []byte
+	releasesAt time.Time
+}
+
+type Args struct {
+	Client          *http.Client
+	AllowHosts      []string
+	ReleasesURL     string
+	ReleasesTTL     time.Duration
+	ReleasesTimeout time.Duration
+}
+
+// New creates the directory layout below dir and returns the cache.
+func New(dir string, args *Args) (*Cache, error) {
+	if args == nil {
+		args = &Args{}
+	}
+	c := &Cache{
+		dir:             dir,
+		client:          args.Client,
+		allowHosts:      args.AllowHosts,
+		releasesURL:     args.ReleasesURL,
+		releasesTTL:     args.ReleasesTTL,
+		releasesTimeout: args.ReleasesTimeout,
+	}
+	if c.client == nil {
+		// Downloading images takes a while, so there is no overall
+		// timeout, but upstream has to start responding in time
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ResponseHeaderTimeout = 30 * time.Second
+		c.client = &http.Client{Transport: transport}
+	}
+	if len(c.allowHosts) == 0 {
+		c.allowHosts = DefaultAllowHosts
+	}
+	if c.releasesURL == "" {
+		c.releasesURL = image.ReleasesURL
+	}
+	if c.releasesTTL == 0 {
+		c.releasesTTL = 10 * time.Minute
+	}
+	if c.releasesTimeout == 0 {
+		c.releasesTimeout = 30 * time.Second
+	}
+	for _, sub := range []string{"blobs/sha256", "refs", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	c.mux = http.NewServeMux()
+	c.mux.HandleFunc("GET /releases", c.handleReleases)
+	c.mux.HandleFunc("GET /fetch/{name}", c.handleFetch)
+	c.mux.HandleFunc("GET /blobs/sha256/{digest}", c.handleBlob)
+	c.mux.HandleFunc("GET /blobs/sha256/{digest}/{name}", c.handleBlob)
+	return c, nil
+}
+
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mux.ServeHTTP(w, r)
+}
+
+// Blob returns the SHA-256 digest of the upstream URL's content,
+// downloading it first unless it is cached already. Concurrent calls
+// for the same URL share one download.
+func (c *Cache) Blob(ctx context.Context, upstreamURL string) (string, error) {
+	if digest, err := c.lookup(upstreamURL); err == nil {
+		return digest, nil
+	}
+	// The download continues when the requesting client goes away, since
+	// other clients might wait for it as well.
+	v, err, _ := c.downloads.Do(upstreamURL, func() (any, error) {
+		return c.download(context.WithoutCancel(ctx), upstreamURL)
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+func (c *Cache) lookup(upstreamURL string) (string, error) {
+	b, err := os.ReadFile(c.refPath(upstreamURL))
+	if err != nil {
+		return "", err
+	}
+	digest := strings.TrimSpace(string(b))
+	if _, err := os.Stat(c.blobPath(digest)); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+func (c *Cache) download(ctx context.Context, upstreamURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstreamURL, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upstream %s responded %s", upstreamURL, res.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(c.dir, "tmp"), "blob-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), res.Body)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if res.ContentLength >= 0 && n != res.ContentLength {
+		tmp.Close()
+		return "", fmt.Errorf("upstream %s sent %d of %d bytes", upstreamURL, n, res.ContentLength)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if err := os.Rename(tmp.Name(), c.blobPath(digest)); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(c.refPath(upstreamURL), []byte(digest+"\n")); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// Releases returns the GitHub releases JSON, which gets cached for the
+// configured TTL. A stale copy is returned when upstream fails or does
+// not respond within the timeout.
+func (c *Cache) Releases(ctx context.Context) ([]byte, error) {
+	c.mu.Lock()
+	cached, at := c.releases, c.releasesAt
+	c.mu.Unlock()
+	if cached != nil && time.Since(at) < c.releasesTTL {
+		return cached, nil
+	}
+	// Concurrent calls share one fetch, which continues when the
+	// requesting client goes away, like downloads do
+	v, err, _ := c.releasesFetch.Do("releases", func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.releasesTimeout)
+		defer cancel()
+		b, err := c.fetchReleases(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.releases, c.releasesAt = b, time.Now()
+		c.mu.Unlock()
+		return b, nil
+	})
+	if err != nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+func (c *Cache) fetchReleases(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.releasesURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream %s responded %s", c.releasesURL, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// Allowed checks whether the upstream URL may be fetched.
+func (c *Cache) Allowed(upstreamURL string) error {
+	u, err := url.Parse(upstreamURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %q is not supported", u.Scheme)
+	}
+	host := u.Hostname()
+	for _, allowed := range c.allowHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q is not allowed", host)
+}
+
+func (c *Cache) handleReleases(w http.ResponseWriter, r *http.Request) {
+	b, err := c.Releases(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (c *Cache) handleFetch(w http.ResponseWriter, r *http.Request) {
+	upstreamURL := r.URL.Query().Get("url")
+	if err := c.Allowed(upstreamURL); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	digest, err := c.Blob(r.Context(), upstreamURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	location := fmt.Sprintf("/blobs/sha256/%s/%s", digest, url.PathEscape(r.PathValue("name")))
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+func (c *Cache) handleBlob(w http.ResponseWriter, r *http.Request) {
+	digest := r.PathValue("digest")
+	if !digestPattern.MatchString(digest) {
+		http.Error(w, "invalid digest", http.StatusBadRequest)
+		return
+	}
+	f, err := os.Open(c.blobPath(digest))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum, _ := hex.DecodeString(digest)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", fmt.Sprintf(`"sha256:%s"`, digest))
+	w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum))
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+func (c *Cache) blobPath(digest string) string {
+	return filepath.Join(c.dir, "blobs", "sha256", digest)
+}
+
+func (c *Cache) refPath(upstreamURL string) string {
+	sum := sha256.Sum256([]byte(upstreamURL))
+	return filepath.Join(c.dir, "refs", hex.EncodeToString(sum[:]))
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
@@ -0,0 +1,134 @@
+package imagecache_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+	"github.com/fabiant7t/totalos/pkg/imagecache"
+)
+
+func TestCache(t *testing.T) {
+	content := strings.Repeat("talos", 1000)
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		io.WriteString(w, content)
+	}))
+	defer upstream.Close()
+
+	c, err := imagecache.New(t.TempDir(), &imagecache.Args{AllowHosts: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	cacheURL := image.CacheURL(srv.URL, upstream.URL+"/metal-amd64.raw.zst")
+	for range 2 {
+		res, err := http.Get(cacheURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if string(b) != content {
+			t.Errorf("got %d bytes, want %d bytes", len(b), len(content))
+		}
+		sum := sha256.Sum256([]byte(content))
+		if want := "/blobs/sha256/" + hex.EncodeToString(sum[:]) + "/metal-amd64.raw.zst"; res.Request.URL.Path != want {
+			t.Errorf("got redirected to %s, want %s", res.Request.URL.Path, want)
+		}
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("upstream got %d requests, want 1", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, cacheURL, nil)
+	req.Header.Set("Range", "bytes=5-9")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent || string(b) != "talos" {
+		t.Errorf("range request: got %s %q, want 206 %q", res.Status, b, "talos")
+	}
+}
+
+func TestCacheRefusesUnknownHosts(t *testing.T) {
+	c, err := imagecache.New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	res, err := http.Get(image.CacheURL(srv.URL, "https://example.com/metal-amd64.raw.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("got %s, want 403", res.Status)
+	}
+}
+
+func TestCacheReleases(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			<-release
+		}
+		io.WriteString(w, "[]")
+	}))
+	defer upstream.Close()
+
+	c, err := imagecache.New(t.TempDir(), &imagecache.Args{ReleasesURL: upstream.URL, ReleasesTTL: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Concurrent calls share the fetch of a slow upstream
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b, err := c.Releases(context.Background()); err != nil || string(b) != "[]" {
+				t.Errorf("got %q, %v", b, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := hits.Load(); got != 1 {
+		t.Errorf("upstream got %d requests, want 1", got)
+	}
+}
+
+func TestCacheReleasesTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	c, err := imagecache.New(t.TempDir(), &imagecache.Args{ReleasesURL: upstream.URL, ReleasesTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Releases(context.Background()); err == nil {
+		t.Error("got no error for an upstream not responding")
+	}
+}
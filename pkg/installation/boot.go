@@ -0,0 +1,13 @@
+package installation
+
+// Boot tells how the written image boots, as read from its partitions.
+type Boot struct {
+	// Mode is the firmware mode the machine boots in, uefi or bios.
+	Mode string `json:"mode"`
+	// Bootloader is grub or systemd-boot, empty if unknown.
+	Bootloader string `json:"bootloader"`
+	// Entry is the default grub menu entry or unified kernel image.
+	Entry        string   `json:"entry"`
+	TalosVersion string   `json:"talos_version"`
+	KernelArgs   []string `json:"kernel_args"`
+}
@@ -0,0 +1,12 @@
+package installation
+
+import "time"
+
+// Bundle tells which offline bundle the image was installed from.
+type Bundle struct {
+	Path    string    `json:"path"`
+	Created time.Time `json:"created"`
+	Version string    `json:"version"`
+	// Configs lists the names of the machine configurations in the bundle.
+	Configs []string `json:"configs,omitempty"`
+}
@@ -1,14 +1,35 @@
 package installation
 
 import (
+	"github.com/fabiant7t/totalos/pkg/extension"
+	"github.com/fabiant7t/totalos/pkg/image"
+	"github.com/fabiant7t/totalos/pkg/meta"
 	"github.com/fabiant7t/totalos/pkg/server"
 )
 
 type Installation struct {
-	Image                             string      `json:"image"`
-	Rebooting                         bool        `json:"rebooting"`
-	Config                            string      `json:"config"`
-	StaticInitialNetworkConfiguration string      `json:"static_initial_network_configuration"`
-	StorageDisk                       server.Disk `json:"storage_disk"`
-	SystemDisk                        server.Disk `json:"system_disk"`
+	Image                               string                     `json:"image"`
+	ImageFormat                         image.Format               `json:"image_format"`
+	ImageReference                      string                     `json:"image_reference,omitempty"`
+	ImageMirrors                        []string                   `json:"image_mirrors,omitempty"`
+	Overlay                             string                     `json:"overlay,omitempty"`
+	SecureBoot                          bool                       `json:"secure_boot"`
+	ImageSHA256                         string                     `json:"image_sha256,omitempty"`
+	ImageAlreadyInstalled               bool                       `json:"image_already_installed"`
+	Rebooting                           bool                       `json:"rebooting"`
+	Config                              string                     `json:"config"`
+	StaticInitialNetworkConfiguration   string                     `json:"static_initial_network_configuration"`
+	StaticInitialNetworkConfigurationV6 string                     `json:"static_initial_network_configuration_v6,omitempty"`
+	MetaNetworkConfig                   *meta.NetworkConfig        `json:"meta_network_config,omitempty"`
+	SerialConsole                       string                     `json:"serial_console,omitempty"`
+	SideroLinkKernelArgs                []string                   `json:"siderolink_kernel_args,omitempty"`
+	NameServers                         []ServerChoice             `json:"name_servers,omitempty"`
+	TimeServers                         []ServerChoice             `json:"time_servers,omitempty"`
+	StorageDisk                         server.Disk                `json:"storage_disk"`
+	SystemDisk                          server.Disk                `json:"system_disk"`
+	Verification                        *Verification              `json:"verification,omitempty"`
+	Boot                                *Boot                      `json:"boot,omitempty"`
+	Bundle                              *Bundle                    `json:"bundle,omitempty"`
+	RecommendedExtensions               []extension.Recommendation `json:"recommended_extensions"`
+	SchematicID                         string                     `json:"schematic_id,omitempty"`
 }
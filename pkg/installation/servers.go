@@ -0,0 +1,71 @@
+package installation
+
+// ServerChoice is a candidate name or time server of the initial network
+// configuration, and why it was chosen or skipped.
+type ServerChoice struct {
+	Address string `json:"address"`
+	// Source is flag (--dns or --ntp), rescue (a resolver of the rescue
+	// system) or fallback.
+	Source string `json:"source"`
+	Chosen bool   `json:"chosen"`
+	Reason string `json:"reason"`
+}
+
+// ChooseServers chooses the first n candidates answering, by the probe
+// results of their addresses (nil error meaning answered). If none
+// answered, like when the rescue system cannot reach them, the first n are
+// chosen unchecked. It returns the chosen candidates and those skipped
+// ahead of them, in order, dropping repeated addresses.
+func ChooseServers(candidates []ServerChoice, probes map[string]error, n int) []ServerChoice {
+	var unique []ServerChoice
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if !seen[c.Address] {
+			seen[c.Address] = true
+			unique = append(unique, c)
+		}
+	}
+	anyAnswered := false
+	for _, c := range unique {
+		if err, ok := probes[c.Address]; ok && err == nil {
+			anyAnswered = true
+		}
+	}
+	var choices []ServerChoice
+	chosen := 0
+	for _, c := range unique {
+		if chosen == n {
+			break
+		}
+		err, probed := probes[c.Address]
+		switch {
+		case probed && err == nil:
+			c.Chosen, c.Reason = true, "answered"
+		case !anyAnswered:
+			c.Chosen, c.Reason = true, "unchecked, no candidate answered"
+			if probed {
+				c.Reason += " (" + err.Error() + ")"
+			}
+		case probed:
+			c.Reason = err.Error()
+		default:
+			c.Reason = "not probed"
+		}
+		if c.Chosen {
+			chosen++
+		}
+		choices = append(choices, c)
+	}
+	return choices
+}
+
+// ChosenAddresses returns the addresses of the chosen servers.
+func ChosenAddresses(choices []ServerChoice) []string {
+	var addrs []string
+	for _, c := range choices {
+		if c.Chosen {
+			addrs = append(addrs, c.Address)
+		}
+	}
+	return addrs
+}
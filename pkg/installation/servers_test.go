@@ -0,0 +1,55 @@
+package installation_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/installation"
+)
+
+func TestChooseServers(t *testing.T) {
+	candidates := []installation.ServerChoice{
+		{Address: "10.0.0.53", Source: "flag"},
+		{Address: "185.12.64.1", Source: "rescue"},
+		{Address: "185.12.64.1", Source: "rescue"},
+		{Address: "185.12.64.2", Source: "rescue"},
+		{Address: "1.1.1.1", Source: "fallback"},
+		{Address: "8.8.8.8", Source: "fallback"},
+	}
+	probes := map[string]error{
+		"10.0.0.53":   errors.New("no answer within 3 seconds"),
+		"185.12.64.1": nil,
+		"185.12.64.2": errors.New("answered REFUSED"),
+		"1.1.1.1":     nil,
+		"8.8.8.8":     nil,
+	}
+	got := installation.ChooseServers(candidates, probes, 2)
+	want := []installation.ServerChoice{
+		{Address: "10.0.0.53", Source: "flag", Reason: "no answer within 3 seconds"},
+		{Address: "185.12.64.1", Source: "rescue", Chosen: true, Reason: "answered"},
+		{Address: "185.12.64.2", Source: "rescue", Reason: "answered REFUSED"},
+		{Address: "1.1.1.1", Source: "fallback", Chosen: true, Reason: "answered"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if addrs := installation.ChosenAddresses(got); !reflect.DeepEqual(addrs, []string{"185.12.64.1", "1.1.1.1"}) {
+		t.Errorf("got %v", addrs)
+	}
+}
+
+func TestChooseServersNoneAnswered(t *testing.T) {
+	candidates := []installation.ServerChoice{
+		{Address: "10.0.0.53", Source: "flag"},
+		{Address: "1.1.1.1", Source: "fallback"},
+	}
+	probes := map[string]error{"10.0.0.53": errors.New("no answer within 3 seconds")}
+	got := installation.ChooseServers(candidates, probes, 1)
+	want := []installation.ServerChoice{
+		{Address: "10.0.0.53", Source: "flag", Chosen: true, Reason: "unchecked, no candidate answered (no answer within 3 seconds)"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,11 @@
+package installation
+
+// Verification is the result of reading back the written system disk
+// and comparing it with the image.
+type Verification struct {
+	Bytes           int64   `json:"bytes"`
+	ImageSHA256     string  `json:"image_sha256"`
+	DiskSHA256      string  `json:"disk_sha256"`
+	Match           bool    `json:"match"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
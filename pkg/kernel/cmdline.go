@@ -0,0 +1,194 @@
+package kernel
+
+import "strings"
+
+// Cmdline is a kernel command line, a list of arguments like key=value,
+// key= (empty value) or key (flag). Keys may repeat, like console.
+type Cmdline []string
+
+// ParseCmdline splits the command line at whitespace. Quoted values
+// containing whitespace are not supported.
+func ParseCmdline(s string) Cmdline {
+	return Cmdline(strings.Fields(s))
+}
+
+// Key returns the key of the argument, the part before the first =.
+func Key(arg string) string {
+	key, _, _ := strings.Cut(arg, "=")
+	return key
+}
+
+// String joins the arguments.
+func (c Cmdline) String() string {
+	return strings.Join(c, " ")
+}
+
+// Get returns the value of the first argument of the key, and whether
+// there is one.
+func (c Cmdline) Get(key string) (string, bool) {
+	for _, arg := range c {
+		if Key(arg) == key {
+			_, value, _ := strings.Cut(arg, "=")
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns the values of all arguments of the key.
+func (c Cmdline) Values(key string) []string {
+	var values []string
+	for _, arg := range c {
+		if Key(arg) == key {
+			_, value, _ := strings.Cut(arg, "=")
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Add appends the argument, unless the command line holds it already.
+func (c Cmdline) Add(arg string) Cmdline {
+	for _, a := range c {
+		if a == arg {
+			return c
+		}
+	}
+	return append(c, arg)
+}
+
+// Replace replaces all arguments of the key of the given ones (which
+// share one key) with them. They take the place of the first argument
+// they replace, or are being appended.
+func (c Cmdline) Replace(args ...string) Cmdline {
+	if len(args) == 0 {
+		return c
+	}
+	key := Key(args[0])
+	out := make(Cmdline, 0, len(c)+len(args))
+	replaced := false
+	for _, a := range c {
+		if Key(a) != key {
+			out = append(out, a)
+			continue
+		}
+		if !replaced {
+			out = append(out, args...)
+			replaced = true
+		}
+	}
+	if !replaced {
+		out = append(out, args...)
+	}
+	return out
+}
+
+// Remove removes all arguments of the keys.
+func (c Cmdline) Remove(keys ...string) Cmdline {
+	out := make(Cmdline, 0, len(c))
+	for _, a := range c {
+		remove := false
+		for _, key := range keys {
+			if Key(a) == key {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Edit is a set of changes to a kernel command line. Applying it twice
+// changes nothing the second time.
+type Edit struct {
+	// Set holds arguments replacing all arguments of their key. Several
+	// arguments of one key (console=tty0 console=ttyS0) are kept in order.
+	Set []string
+	// Remove holds keys whose arguments are being removed.
+	Remove []string
+}
+
+// Empty tells whether the edit changes nothing.
+func (e *Edit) Empty() bool {
+	return e == nil || len(e.Set) == 0 && len(e.Remove) == 0
+}
+
+// Apply returns the command line with the arguments removed, then set.
+func (e *Edit) Apply(c Cmdline) Cmdline {
+	if e.Empty() {
+		return c
+	}
+	out := c.Remove(e.Remove...)
+	var keys []string
+	byKey := make(map[string][]string)
+	for _, arg := range e.Set {
+		key := Key(arg)
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], arg)
+	}
+	for _, key := range keys {
+		out = out.Replace(byKey[key]...)
+	}
+	return out
+}
+
+// Satisfied tells whether the command line holds the edit: the arguments
+// of every key set are exactly the ones set, and no key removed is left.
+func (e *Edit) Satisfied(c Cmdline) bool {
+	if e.Empty() {
+		return true
+	}
+	want := make(map[string][]string)
+	for _, arg := range e.Set {
+		want[Key(arg)] = append(want[Key(arg)], arg)
+	}
+	for _, key := range e.Remove {
+		if _, ok := want[key]; !ok {
+			want[key] = nil
+		}
+	}
+	got := make(map[string][]string)
+	for _, arg := range c {
+		if _, ok := want[Key(arg)]; ok {
+			got[Key(arg)] = append(got[Key(arg)], arg)
+		}
+	}
+	for key, args := range want {
+		if strings.Join(got[key], " ") != strings.Join(args, " ") {
+			return false
+		}
+	}
+	return true
+}
+
+// ExtraKernelArgs returns the edit as Talos extraKernelArgs (of the Image
+// Factory or machine config), which are appended to the default command
+// line. A negated key (-console) removes the default arguments of the key,
+// so every key set or removed is being negated ahead of the arguments set.
+func (e *Edit) ExtraKernelArgs() []string {
+	if e.Empty() {
+		return nil
+	}
+	var args []string
+	negated := make(map[string]bool)
+	for _, key := range append(append([]string{}, e.Remove...), keysOf(e.Set)...) {
+		if !negated[key] {
+			negated[key] = true
+			args = append(args, "-"+key)
+		}
+	}
+	return append(args, e.Set...)
+}
+
+func keysOf(args []string) []string {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = Key(arg)
+	}
+	return keys
+}
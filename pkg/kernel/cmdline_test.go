@@ -0,0 +1,115 @@
+package kernel_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/kernel"
+)
+
+func TestCmdlineEdit(t *testing.T) {
+	orig := "talos.platform=metal console=tty0 console=ttyS0 init_on_alloc=1 talos.config=https://old/config.yaml"
+	for _, tc := range []struct {
+		name string
+		edit *kernel.Edit
+		want string
+	}{
+		{"nothing", &kernel.Edit{}, orig},
+		{
+			"replace in place",
+			&kernel.Edit{Set: []string{"talos.config=https://example.com/config.yaml"}},
+			"talos.platform=metal console=tty0 console=ttyS0 init_on_alloc=1 talos.config=https://example.com/config.yaml",
+		},
+		{
+			"append",
+			&kernel.Edit{Set: []string{"talos.dashboard.disabled=1", "quiet"}},
+			orig + " talos.dashboard.disabled=1 quiet",
+		},
+		{
+			"replace repeated key with several",
+			&kernel.Edit{Set: []string{"console=ttyS1,115200n8", "console=tty0"}},
+			"talos.platform=metal console=ttyS1,115200n8 console=tty0 init_on_alloc=1 talos.config=https://old/config.yaml",
+		},
+		{
+			"empty value",
+			&kernel.Edit{Set: []string{"console="}},
+			"talos.platform=metal console= init_on_alloc=1 talos.config=https://old/config.yaml",
+		},
+		{
+			"remove",
+			&kernel.Edit{Remove: []string{"console", "talos.config", "absent"}},
+			"talos.platform=metal init_on_alloc=1",
+		},
+	} {
+		once := tc.edit.Apply(kernel.ParseCmdline(orig))
+		if got := once.String(); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+		if twice := tc.edit.Apply(once).String(); twice != tc.want {
+			t.Errorf("%s: applied twice, got %q, want %q", tc.name, twice, tc.want)
+		}
+	}
+}
+
+func TestCmdlineGet(t *testing.T) {
+	c := kernel.ParseCmdline("talos.platform=metal console= quiet console=ttyS0")
+	for _, tc := range []struct {
+		key       string
+		wantValue string
+		wantOK    bool
+	}{
+		{"talos.platform", "metal", true},
+		{"console", "", true},
+		{"quiet", "", true},
+		{"ip", "", false},
+	} {
+		if value, ok := c.Get(tc.key); value != tc.wantValue || ok != tc.wantOK {
+			t.Errorf("%s: got %q, %t, want %q, %t", tc.key, value, ok, tc.wantValue, tc.wantOK)
+		}
+	}
+	if got := c.Values("console"); len(got) != 2 || got[0] != "" || got[1] != "ttyS0" {
+		t.Errorf("got console values %q", got)
+	}
+	if got := c.Add("quiet").Add("nomodeset").String(); got != "talos.platform=metal console= quiet console=ttyS0 nomodeset" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestEditSatisfied(t *testing.T) {
+	edit := &kernel.Edit{
+		Set:    []string{"talos.config=https://example.com/config.yaml", "console=ttyS0"},
+		Remove: []string{"talos.dashboard.disabled", "console"},
+	}
+	for _, tc := range []struct {
+		cmdline string
+		want    bool
+	}{
+		{"talos.platform=metal console=ttyS0 talos.config=https://example.com/config.yaml", true},
+		{"console=ttyS0 talos.platform=metal talos.config=https://example.com/config.yaml", true},
+		{"talos.platform=metal console=tty0 console=ttyS0 talos.config=https://example.com/config.yaml", false},
+		{"talos.platform=metal console=ttyS0 talos.config=https://old/config.yaml", false},
+		{"talos.platform=metal console=ttyS0", false},
+		{"console=ttyS0 talos.config=https://example.com/config.yaml talos.dashboard.disabled=1", false},
+	} {
+		if got := edit.Satisfied(kernel.ParseCmdline(tc.cmdline)); got != tc.want {
+			t.Errorf("%q: got %t, want %t", tc.cmdline, got, tc.want)
+		}
+	}
+	if !edit.Satisfied(edit.Apply(kernel.ParseCmdline("talos.platform=metal console=tty0 talos.dashboard.disabled=1"))) {
+		t.Error("applied edit is not satisfied")
+	}
+}
+
+func TestEditExtraKernelArgs(t *testing.T) {
+	edit := &kernel.Edit{
+		Set:    []string{"console=ttyS1", "console=tty0", "talos.config=https://example.com/config.yaml"},
+		Remove: []string{"talos.dashboard.disabled", "console"},
+	}
+	want := "-talos.dashboard.disabled -console -talos.config console=ttyS1 console=tty0 talos.config=https://example.com/config.yaml"
+	if got := strings.Join(edit.ExtraKernelArgs(), " "); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := (&kernel.Edit{}).ExtraKernelArgs(); got != nil {
+		t.Errorf("empty edit: got %q", got)
+	}
+}
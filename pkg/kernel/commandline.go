@@ -1,6 +1,89 @@
 package kernel
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// IPOption is a static ip= option value, *IPOptionStaticV4 or
+// *IPOptionStaticV6.
+type IPOption interface {
+	String() string
+	Validate() error
+}
+
+// ErrNoStaticIPOption is returned by ParseIPOption for ip= options
+// leaving the address to autoconfiguration, like ip=dhcp.
+var ErrNoStaticIPOption = errors.New("no static ip= option")
+
+// ParseIPOption parses a static ip= option value (with or without ip=) of
+// the form <client>:<server>:<gateway>:<netmask>:<hostname>:<device>:off
+// followed by up to two DNS servers and an NTP server, trailing fields may
+// be omitted. A bracketed or IPv6 client address makes an
+// IPOptionStaticV6, whose netmask is the prefix length. The server is
+// ignored, the value is not validated.
+func ParseIPOption(s string) (IPOption, error) {
+	s = strings.TrimPrefix(s, "ip=")
+	fields := splitIPOption(s)
+	if len(fields) > 10 {
+		return nil, fmt.Errorf("ip=%s has more than 10 fields", s)
+	}
+	// Keywords like dhcp or off stand alone
+	keyword := len(fields) == 1 && !strings.ContainsAny(s, ".:")
+	fields = append(fields, make([]string, 10-len(fields))...)
+	if autoconf := fields[6]; keyword || fields[0] == "" || (autoconf != "" && autoconf != "off" && autoconf != "none") {
+		return nil, fmt.Errorf("ip=%s: %w", s, ErrNoStaticIPOption)
+	}
+	if !strings.HasPrefix(fields[0], "[") && !isIPv6(fields[0]) {
+		return &IPOptionStaticV4{
+			ClientIP:  fields[0],
+			GatewayIP: fields[2],
+			Netmask:   fields[3],
+			Hostname:  fields[4],
+			Device:    fields[5],
+			DNS0IP:    fields[7],
+			DNS1IP:    fields[8],
+			NTP0IP:    fields[9],
+		}, nil
+	}
+	prefixLength, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("ip=%s: prefix length %q is no number", s, fields[3])
+	}
+	return &IPOptionStaticV6{
+		ClientIP:     unbracket(fields[0]),
+		PrefixLength: prefixLength,
+		GatewayIP:    unbracket(fields[2]),
+		Hostname:     fields[4],
+		Device:       fields[5],
+		DNS0IP:       unbracket(fields[7]),
+		DNS1IP:       unbracket(fields[8]),
+		NTP0IP:       unbracket(fields[9]),
+	}, nil
+}
+
+// splitIPOption splits the value at the colons outside of brackets.
+func splitIPOption(s string) []string {
+	var fields []string
+	start, inBracket := 0, false
+	for i, c := range s {
+		switch {
+		case c == '[':
+			inBracket = true
+		case c == ']':
+			inBracket = false
+		case c == ':' && !inBracket:
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, s[start:])
+}
 
 // IPOptionStaticV4 is used to build the ip= option of the kernel commandline
 type IPOptionStaticV4 struct {
@@ -28,3 +111,191 @@ func (c *IPOptionStaticV4) String() string {
 		c.NTP0IP,
 	)
 }
+
+// Validate checks that the client and gateway addresses are IPv4, the
+// netmask is a valid IPv4 netmask (or prefix length) and the hostname,
+// device, DNS and NTP servers are valid. The gateway may be outside the
+// network of the client, like on Hetzner Cloud.
+func (c *IPOptionStaticV4) Validate() error {
+	client, err := netip.ParseAddr(c.ClientIP)
+	if err != nil || !client.Is4() {
+		return fmt.Errorf("client IP %q is no IPv4 address", c.ClientIP)
+	}
+	if !client.IsGlobalUnicast() {
+		return fmt.Errorf("client IP %s is no unicast address", c.ClientIP)
+	}
+	gateway, err := netip.ParseAddr(c.GatewayIP)
+	if err != nil || !gateway.Is4() {
+		return fmt.Errorf("gateway IP %q is no IPv4 address", c.GatewayIP)
+	}
+	if gateway == client {
+		return fmt.Errorf("gateway IP %s is the client IP", c.GatewayIP)
+	}
+	if err := validateIPv4Netmask(c.Netmask); err != nil {
+		return err
+	}
+	return validateIPOptionCommon(c.Hostname, c.Device, c.DNS0IP, c.DNS1IP, c.NTP0IP)
+}
+
+// validateIPv4Netmask checks a netmask like 255.255.255.0, or a prefix
+// length like 24, within /1 and /32.
+func validateIPv4Netmask(netmask string) error {
+	if n, err := strconv.Atoi(netmask); err == nil {
+		if n < 1 || n > 32 {
+			return fmt.Errorf("netmask %s is not within 1 and 32", netmask)
+		}
+		return nil
+	}
+	mask, err := netip.ParseAddr(netmask)
+	if err != nil || !mask.Is4() {
+		return fmt.Errorf("netmask %q is no IPv4 netmask", netmask)
+	}
+	b := mask.As4()
+	ones := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	if bits.LeadingZeros32(^ones) != bits.OnesCount32(ones) || ones == 0 {
+		return fmt.Errorf("netmask %s is no contiguous IPv4 netmask", netmask)
+	}
+	return nil
+}
+
+var (
+	// hostnameLabel is a single label of RFC 1123, a domain is not taken
+	hostnameLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	// deviceName is a Linux interface name, 15 bytes at most
+	deviceName = regexp.MustCompile(`^[^/:\s]{1,15}$`)
+)
+
+// validateIPOptionCommon checks the fields both families share. Hostname,
+// device, DNS and NTP servers are optional.
+func validateIPOptionCommon(hostname, device string, servers ...string) error {
+	if hostname != "" && !hostnameLabel.MatchString(hostname) {
+		return fmt.Errorf("hostname %q is no single label of letters, digits and hyphens (up to 63)", hostname)
+	}
+	if device != "" && (!deviceName.MatchString(device) || device == "." || device == "..") {
+		return fmt.Errorf("device %q is no interface name", device)
+	}
+	for i, addr := range servers {
+		if addr == "" {
+			continue
+		}
+		if ip, err := netip.ParseAddr(addr); err != nil || ip.Zone() != "" {
+			return fmt.Errorf("%s IP %q is no IP address", []string{"DNS0", "DNS1", "NTP0"}[i], addr)
+		}
+	}
+	return nil
+}
+
+// IPOptionStaticV6 is used to build the ip= option of the kernel
+// commandline for IPv6. Addresses are bracketed, the netmask is given by
+// the prefix length. The gateway may be link-local, like fe80::1.
+type IPOptionStaticV6 struct {
+	ClientIP     string
+	PrefixLength int
+	GatewayIP    string
+	Hostname     string
+	Device       string
+	DNS0IP       string
+	DNS1IP       string
+	NTP0IP       string
+}
+
+// String returns the ip= option value
+func (c *IPOptionStaticV6) String() string {
+	return fmt.Sprintf(
+		"%s::%s:%d:%s:%s:off:%s:%s:%s",
+		bracket(c.ClientIP),
+		bracket(c.GatewayIP),
+		c.PrefixLength,
+		c.Hostname,
+		c.Device,
+		bracket(c.DNS0IP),
+		bracket(c.DNS1IP),
+		bracket(c.NTP0IP),
+	)
+}
+
+// Validate checks that the addresses are IPv6 (DNS and NTP servers may be
+// IPv4 as well, or missing), the prefix length is within 1 and 128 and
+// the hostname and device are valid.
+func (c *IPOptionStaticV6) Validate() error {
+	client, err := netip.ParseAddr(c.ClientIP)
+	if err != nil || !client.Is6() || client.Is4In6() || client.Zone() != "" {
+		return fmt.Errorf("client IP %q is no IPv6 address", c.ClientIP)
+	}
+	if !client.IsGlobalUnicast() {
+		return fmt.Errorf("client IP %s is no global unicast address, like a link-local one", c.ClientIP)
+	}
+	if c.PrefixLength < 1 || c.PrefixLength > 128 {
+		return fmt.Errorf("prefix length %d is not within 1 and 128", c.PrefixLength)
+	}
+	gateway, err := netip.ParseAddr(c.GatewayIP)
+	if err != nil || !gateway.Is6() || gateway.Is4In6() || gateway.Zone() != "" {
+		return fmt.Errorf("gateway IP %q is no IPv6 address", c.GatewayIP)
+	}
+	if gateway == client {
+		return fmt.Errorf("gateway IP %s is the client IP", c.GatewayIP)
+	}
+	return validateIPOptionCommon(c.Hostname, c.Device, c.DNS0IP, c.DNS1IP, c.NTP0IP)
+}
+
+// BondOption is used to build the bond= option of the kernel commandline,
+// like bond0:enp1s0f0,enp1s0f1:mode=802.3ad,xmit_hash_policy=layer3+4
+type BondOption struct {
+	Name   string
+	Slaves []string
+	// Options like mode=802.3ad, the mode first.
+	Options []string
+	// MTU of the bond, 0 keeps the default.
+	MTU int
+}
+
+// String returns the bond= option value
+func (b *BondOption) String() string {
+	s := fmt.Sprintf("%s:%s:%s", b.Name, strings.Join(b.Slaves, ","), strings.Join(b.Options, ","))
+	if b.MTU > 0 {
+		s += ":" + strconv.Itoa(b.MTU)
+	}
+	return s
+}
+
+// VLANOption is used to build the vlan= option of the kernel commandline,
+// like enp1s0f0.4000:enp1s0f0
+type VLANOption struct {
+	Parent string
+	ID     int
+}
+
+// Interface returns the name of the VLAN sub-interface, <parent>.<id>
+func (v *VLANOption) Interface() string {
+	return fmt.Sprintf("%s.%d", v.Parent, v.ID)
+}
+
+// String returns the vlan= option value
+func (v *VLANOption) String() string {
+	return v.Interface() + ":" + v.Parent
+}
+
+func isIPv6(s string) bool {
+	ip, err := netip.ParseAddr(s)
+	return err == nil && ip.Is6()
+}
+
+// bracket encloses IPv6 addresses in brackets, as their colons separate
+// the fields of the ip= option otherwise.
+func bracket(addr string) string {
+	if strings.Contains(addr, ":") {
+		return "[" + addr + "]"
+	}
+	return addr
+}
+
+func unbracket(addr string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// ConsoleArgs returns the console= arguments to log to the screen and to
+// the serial port (like ttyS1,115200n8). The last console is /dev/console,
+// so the serial port gets the output of Talos besides the kernel messages.
+func ConsoleArgs(serial string) []string {
+	return []string{"console=tty0", "console=" + serial}
+}
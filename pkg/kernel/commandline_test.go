@@ -1,6 +1,9 @@
 package kernel_test
 
 import (
+	"errors"
+	"reflect"
+	"slices"
 	"testing"
 
 	"github.com/fabiant7t/totalos/pkg/kernel"
@@ -21,3 +24,184 @@ func TestIPOptionStaticV4String(t *testing.T) {
 		t.Errorf("got %s, want %s", got, want)
 	}
 }
+
+func TestIPOptionStaticV4Validate(t *testing.T) {
+	valid := kernel.IPOptionStaticV4{
+		ClientIP:  "203.0.113.10",
+		GatewayIP: "203.0.113.1",
+		Netmask:   "255.255.255.0",
+		Hostname:  "talos-203-0-113-10",
+		Device:    "enp0s31f6",
+		DNS0IP:    "1.1.1.1",
+		DNS1IP:    "2606:4700:4700::1111",
+		NTP0IP:    "162.159.200.1",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("got %v", err)
+	}
+	for name, edit := range map[string]func(o *kernel.IPOptionStaticV4){
+		"hetzner cloud gateway": func(o *kernel.IPOptionStaticV4) { o.Netmask, o.GatewayIP = "255.255.255.255", "172.31.1.1" },
+		"prefix length":         func(o *kernel.IPOptionStaticV4) { o.Netmask = "24" },
+		"no hostname":           func(o *kernel.IPOptionStaticV4) { o.Hostname = "" },
+		"no dns":                func(o *kernel.IPOptionStaticV4) { o.DNS0IP, o.DNS1IP, o.NTP0IP = "", "", "" },
+	} {
+		opt := valid
+		edit(&opt)
+		if err := opt.Validate(); err != nil {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+	for name, edit := range map[string]func(o *kernel.IPOptionStaticV4){
+		"ipv6 client":          func(o *kernel.IPOptionStaticV4) { o.ClientIP = "2001:db8::2" },
+		"no gateway":           func(o *kernel.IPOptionStaticV4) { o.GatewayIP = "" },
+		"gateway is client":    func(o *kernel.IPOptionStaticV4) { o.GatewayIP = o.ClientIP },
+		"no netmask":           func(o *kernel.IPOptionStaticV4) { o.Netmask = "" },
+		"gappy netmask":        func(o *kernel.IPOptionStaticV4) { o.Netmask = "255.0.255.0" },
+		"zero netmask":         func(o *kernel.IPOptionStaticV4) { o.Netmask = "0.0.0.0" },
+		"long prefix":          func(o *kernel.IPOptionStaticV4) { o.Netmask = "33" },
+		"dot in hostname":      func(o *kernel.IPOptionStaticV4) { o.Hostname = "node1.example.com" },
+		"hyphen ends hostname": func(o *kernel.IPOptionStaticV4) { o.Hostname = "node-" },
+		"colon in device":      func(o *kernel.IPOptionStaticV4) { o.Device = "eth0:1" },
+		"long device":          func(o *kernel.IPOptionStaticV4) { o.Device = "enp0s31f6.40001x" },
+		"invalid ntp":          func(o *kernel.IPOptionStaticV4) { o.NTP0IP = "time.cloudflare.com" },
+	} {
+		opt := valid
+		edit(&opt)
+		if err := opt.Validate(); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestParseIPOption(t *testing.T) {
+	for _, want := range []kernel.IPOption{
+		&kernel.IPOptionStaticV4{
+			ClientIP:  "203.0.113.10",
+			GatewayIP: "203.0.113.1",
+			Netmask:   "255.255.255.0",
+			Hostname:  "talos-203-0-113-10",
+			Device:    "bond0.4000",
+			DNS0IP:    "1.1.1.1",
+			DNS1IP:    "8.8.8.8",
+			NTP0IP:    "162.159.200.1",
+		},
+		&kernel.IPOptionStaticV4{ClientIP: "203.0.113.10", GatewayIP: "203.0.113.1", Netmask: "24"},
+		&kernel.IPOptionStaticV6{
+			ClientIP:     "2a01:4f8:10a:1f2::2",
+			PrefixLength: 64,
+			GatewayIP:    "fe80::1",
+			Hostname:     "talos-node",
+			Device:       "eno1",
+			DNS0IP:       "2a01:4ff:ff00::add:1",
+			DNS1IP:       "185.12.64.1",
+			NTP0IP:       "2606:4700:f1::1",
+		},
+	} {
+		got, err := kernel.ParseIPOption("ip=" + want.String())
+		if err != nil {
+			t.Errorf("%s: got %v", want, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	}
+
+	got, err := kernel.ParseIPOption("203.0.113.10::203.0.113.1:255.255.255.0::eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&kernel.IPOptionStaticV4{ClientIP: "203.0.113.10", GatewayIP: "203.0.113.1", Netmask: "255.255.255.0", Device: "eth0"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	for _, s := range []string{"dhcp", "ip=:::::eth0:dhcp", "203.0.113.10::203.0.113.1:255.255.255.0::eth0:dhcp"} {
+		if _, err := kernel.ParseIPOption(s); !errors.Is(err, kernel.ErrNoStaticIPOption) {
+			t.Errorf("%s: got %v, want ErrNoStaticIPOption", s, err)
+		}
+	}
+	for _, s := range []string{
+		"[2001:db8::2]::[2001:db8::1]:ffff::eth0:off",
+		"203.0.113.10::203.0.113.1:255.255.255.0::eth0:off:1.1.1.1:8.8.8.8:162.159.200.1:extra",
+	} {
+		if _, err := kernel.ParseIPOption(s); err == nil {
+			t.Errorf("%s: got no error", s)
+		}
+	}
+}
+
+func TestIPOptionStaticV6String(t *testing.T) {
+	opt := kernel.IPOptionStaticV6{
+		ClientIP:     "2a01:4f8:10a:1f2::2",
+		PrefixLength: 64,
+		GatewayIP:    "fe80::1",
+		Hostname:     "talos-node",
+		Device:       "eno1",
+		DNS0IP:       "2a01:4ff:ff00::add:1",
+		DNS1IP:       "185.12.64.1",
+		NTP0IP:       "2606:4700:f1::123",
+	}
+	want := "[2a01:4f8:10a:1f2::2]::[fe80::1]:64:talos-node:eno1:off:[2a01:4ff:ff00::add:1]:185.12.64.1:[2606:4700:f1::123]"
+	if got := opt.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if err := opt.Validate(); err != nil {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestIPOptionStaticV6Validate(t *testing.T) {
+	valid := kernel.IPOptionStaticV6{ClientIP: "2001:db8::2", PrefixLength: 64, GatewayIP: "2001:db8::1", Device: "eth0"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("got %v", err)
+	}
+	for name, edit := range map[string]func(o *kernel.IPOptionStaticV6){
+		"ipv4 client":       func(o *kernel.IPOptionStaticV6) { o.ClientIP = "192.168.0.42" },
+		"link-local client": func(o *kernel.IPOptionStaticV6) { o.ClientIP = "fe80::2" },
+		"no prefix length":  func(o *kernel.IPOptionStaticV6) { o.PrefixLength = 0 },
+		"long prefix":       func(o *kernel.IPOptionStaticV6) { o.PrefixLength = 129 },
+		"no gateway":        func(o *kernel.IPOptionStaticV6) { o.GatewayIP = "" },
+		"ipv4 gateway":      func(o *kernel.IPOptionStaticV6) { o.GatewayIP = "192.168.0.1" },
+		"invalid dns":       func(o *kernel.IPOptionStaticV6) { o.DNS1IP = "dns.example.com" },
+		"colon in hostname": func(o *kernel.IPOptionStaticV6) { o.Hostname = "2001:db8::2" },
+	} {
+		opt := valid
+		edit(&opt)
+		if err := opt.Validate(); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestBondOptionString(t *testing.T) {
+	opt := kernel.BondOption{
+		Name:    "bond0",
+		Slaves:  []string{"enp1s0f0", "enp1s0f1"},
+		Options: []string{"mode=802.3ad", "xmit_hash_policy=layer3+4", "lacp_rate=fast", "miimon=100"},
+	}
+	want := "bond0:enp1s0f0,enp1s0f1:mode=802.3ad,xmit_hash_policy=layer3+4,lacp_rate=fast,miimon=100"
+	if got := opt.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	opt.MTU = 9000
+	if got := opt.String(); got != want+":9000" {
+		t.Errorf("got %s, want %s:9000", got, want)
+	}
+}
+
+func TestVLANOptionString(t *testing.T) {
+	opt := kernel.VLANOption{Parent: "bond0", ID: 4000}
+	if got, want := opt.String(), "bond0.4000:bond0"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := opt.Interface(), "bond0.4000"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestConsoleArgs(t *testing.T) {
+	got := kernel.ConsoleArgs("ttyS1,115200n8")
+	if want := []string{"console=tty0", "console=ttyS1,115200n8"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
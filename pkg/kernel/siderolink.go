@@ -0,0 +1,66 @@
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// SideroLink tunnel endpoints of Omni for the events and kernel logs of a
+// machine, the same for every account.
+const (
+	SideroLinkEventsSink    = "[fdae:41e4:649b:9303::1]:8090"
+	SideroLinkLoggingKernel = "tcp://[fdae:41e4:649b:9303::1]:8092"
+)
+
+var joinToken = regexp.MustCompile(`([?&]jointoken=)[^&]*`)
+
+// SideroLinkArgs returns the kernel arguments joining a machine to Omni:
+// siderolink.api with the API URL, talos.events.sink and
+// talos.logging.kernel. The URL has to be https:// (or http:// and grpc://
+// for insecure self-hosted instances) and carry the join token, like
+// https://account.siderolink.omni.siderolabs.io?jointoken=....
+func SideroLinkArgs(api string) ([]string, error) {
+	if strings.ContainsAny(api, " \t\n\"'") {
+		return nil, errors.New("SideroLink API URL contains whitespace or quotes")
+	}
+	u, err := url.Parse(api)
+	if err != nil {
+		// The error of url.Parse quotes the URL, join token included
+		return nil, fmt.Errorf("invalid SideroLink API URL: %s", RedactJoinToken(err.Error()))
+	}
+	if u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "grpc" {
+		return nil, fmt.Errorf("SideroLink API URL %s is no https://, http:// or grpc:// URL", RedactJoinToken(api))
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("SideroLink API URL %s has no host", RedactJoinToken(api))
+	}
+	if u.Query().Get("jointoken") == "" {
+		return nil, fmt.Errorf("SideroLink API URL %s has no jointoken", RedactJoinToken(api))
+	}
+	return []string{
+		"siderolink.api=" + api,
+		"talos.events.sink=" + SideroLinkEventsSink,
+		"talos.logging.kernel=" + SideroLinkLoggingKernel,
+	}, nil
+}
+
+// RedactJoinToken replaces the join token in s, like an argument or URL,
+// by REDACTED.
+func RedactJoinToken(s string) string {
+	return joinToken.ReplaceAllString(s, "${1}REDACTED")
+}
+
+// RedactJoinTokens returns the arguments with their join tokens redacted.
+func RedactJoinTokens(args []string) []string {
+	if args == nil {
+		return nil
+	}
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = RedactJoinToken(arg)
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package kernel_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/kernel"
+)
+
+func TestSideroLinkArgs(t *testing.T) {
+	got, err := kernel.SideroLinkArgs("https://acme.siderolink.omni.siderolabs.io?jointoken=s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"siderolink.api=https://acme.siderolink.omni.siderolabs.io?jointoken=s3cr3t",
+		"talos.events.sink=[fdae:41e4:649b:9303::1]:8090",
+		"talos.logging.kernel=tcp://[fdae:41e4:649b:9303::1]:8092",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, api := range []string{
+		"acme.siderolink.omni.siderolabs.io?jointoken=s3cr3t",
+		"ftp://omni.example.com?jointoken=s3cr3t",
+		"https://omni.example.com",
+		"https://omni.example.com?jointoken=",
+		"https://?jointoken=s3cr3t",
+		"https://omni.example.com?jointoken=s3 cr3t",
+		"https://omni:x/?jointoken=s3cr3t",
+	} {
+		_, err := kernel.SideroLinkArgs(api)
+		if err == nil {
+			t.Errorf("%s: got no error", api)
+		} else if strings.Contains(err.Error(), "s3cr3t") {
+			t.Errorf("%s: error %q reveals the join token", api, err)
+		}
+	}
+}
+
+func TestRedactJoinTokens(t *testing.T) {
+	got := kernel.RedactJoinTokens([]string{
+		"talos.platform=metal",
+		"siderolink.api=https://omni.example.com:8090/?jointoken=s3cr3t&grpc_tunnel=true",
+	})
+	want := []string{
+		"talos.platform=metal",
+		"siderolink.api=https://omni.example.com:8090/?jointoken=REDACTED&grpc_tunnel=true",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,113 @@
+// Package meta reads and writes the META partition of Talos, which holds
+// tagged values (keys) Talos reads on boot, like the network platform
+// config of bare metal.
+package meta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// Length of one copy of the META data, the partition holds two.
+	Length = 256 * 1024
+	// dataLength is the room for tags, between magic1 and the checksum.
+	dataLength = Length - 4 - 32 - 4
+
+	magic1 = 0x5a4b3c2d
+	magic2 = 0xa5b4c3d2
+)
+
+// Keys of values Talos reads.
+const (
+	// MetalNetworkPlatformConfig is the network configuration (YAML) of
+	// the metal platform, applied on boot like a platform network config.
+	MetalNetworkPlatformConfig uint8 = 0x0a
+)
+
+// Keys Talos leaves to users (UserReserved3).
+const (
+	// InstalledImage is the record of the image totalos has written, on
+	// images without a boot partition.
+	InstalledImage uint8 = 0x0e
+)
+
+// Meta are the values of the META partition by key.
+type Meta map[uint8][]byte
+
+// Marshal returns both copies of the META data (2*Length bytes). Each is
+// laid out big-endian as magic1, the tags (each as tag, size and value,
+// ending with tag 0), zero padding, the SHA-256 of the copy with the
+// checksum zeroed, and magic2.
+func (m Meta) Marshal() ([]byte, error) {
+	buf := make([]byte, Length)
+	binary.BigEndian.PutUint32(buf[0:4], magic1)
+	binary.BigEndian.PutUint32(buf[Length-4:], magic2)
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		if k == 0 {
+			return nil, errors.New("META key 0 is reserved")
+		}
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	data := buf[4 : 4+dataLength]
+	for _, k := range keys {
+		value := m[uint8(k)]
+		if len(data) < 8+len(value) {
+			return nil, fmt.Errorf("META values exceed %d bytes", dataLength)
+		}
+		binary.BigEndian.PutUint32(data[0:4], uint32(k))
+		binary.BigEndian.PutUint32(data[4:8], uint32(len(value)))
+		copy(data[8:], value)
+		data = data[8+len(value):]
+	}
+	sum := sha256.Sum256(buf)
+	copy(buf[Length-36:Length-4], sum[:])
+	return append(buf, buf...), nil
+}
+
+// Unmarshal parses the first intact copy of the META data. Data without
+// an intact copy, like the zeroed META partition of a fresh image, holds
+// no values.
+func Unmarshal(b []byte) (Meta, error) {
+	for _, offset := range []int{0, Length} {
+		if len(b) < offset+Length {
+			break
+		}
+		if m, err := unmarshalCopy(b[offset : offset+Length]); err == nil {
+			return m, nil
+		}
+	}
+	return Meta{}, nil
+}
+
+func unmarshalCopy(buf []byte) (Meta, error) {
+	if binary.BigEndian.Uint32(buf[0:4]) != magic1 || binary.BigEndian.Uint32(buf[Length-4:]) != magic2 {
+		return nil, errors.New("no META magic")
+	}
+	zeroed := bytes.Clone(buf)
+	clear(zeroed[Length-36 : Length-4])
+	if sum := sha256.Sum256(zeroed); !bytes.Equal(sum[:], buf[Length-36:Length-4]) {
+		return nil, errors.New("META checksum mismatch")
+	}
+	m := Meta{}
+	data := buf[4 : 4+dataLength]
+	for len(data) >= 8 {
+		tag := binary.BigEndian.Uint32(data[0:4])
+		if tag == 0 {
+			break
+		}
+		size := binary.BigEndian.Uint32(data[4:8])
+		if uint64(size) > uint64(len(data)-8) {
+			return nil, errors.New("META value exceeds data")
+		}
+		m[uint8(tag)] = bytes.Clone(data[8 : 8+size])
+		data = data[8+size:]
+	}
+	return m, nil
+}
@@ -0,0 +1,75 @@
+package meta_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/meta"
+)
+
+func TestMarshal(t *testing.T) {
+	m := meta.Meta{meta.MetalNetworkPlatformConfig: []byte("addresses: []\n"), 0x0c: []byte("x")}
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 2*meta.Length || !bytes.Equal(b[:meta.Length], b[meta.Length:]) {
+		t.Fatalf("got %d bytes, want two equal copies of %d", len(b), meta.Length)
+	}
+	// Layout: magic1, tags in order, checksum, magic2
+	copy1 := b[:meta.Length]
+	if got := binary.BigEndian.Uint32(copy1[0:4]); got != 0x5a4b3c2d {
+		t.Errorf("got magic1 %#x", got)
+	}
+	if got := binary.BigEndian.Uint32(copy1[meta.Length-4:]); got != 0xa5b4c3d2 {
+		t.Errorf("got magic2 %#x", got)
+	}
+	if tag, size := binary.BigEndian.Uint32(copy1[4:8]), binary.BigEndian.Uint32(copy1[8:12]); tag != 0x0a || size != 14 {
+		t.Errorf("got first tag %#x of %d bytes", tag, size)
+	}
+	if tag := binary.BigEndian.Uint32(copy1[26:30]); tag != 0x0c {
+		t.Errorf("got second tag %#x", tag)
+	}
+	zeroed := bytes.Clone(copy1)
+	clear(zeroed[meta.Length-36 : meta.Length-4])
+	if sum := sha256.Sum256(zeroed); !bytes.Equal(sum[:], copy1[meta.Length-36:meta.Length-4]) {
+		t.Error("checksum mismatch")
+	}
+
+	got, err := meta.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || string(got[meta.MetalNetworkPlatformConfig]) != "addresses: []\n" || string(got[0x0c]) != "x" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestUnmarshalDamaged(t *testing.T) {
+	b, err := meta.Meta{meta.MetalNetworkPlatformConfig: []byte("links: []\n")}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A damaged first copy falls back to the second one
+	b[100] ^= 0xff
+	got, err := meta.Unmarshal(b)
+	if err != nil || string(got[meta.MetalNetworkPlatformConfig]) != "links: []\n" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	// Zeroed data of a fresh image holds no values
+	got, err = meta.Unmarshal(make([]byte, 2*meta.Length))
+	if err != nil || len(got) != 0 {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestMarshalTooLarge(t *testing.T) {
+	if _, err := (meta.Meta{0x0a: make([]byte, meta.Length)}).Marshal(); err == nil {
+		t.Error("got no error")
+	}
+	if _, err := (meta.Meta{0: []byte("x")}).Marshal(); err == nil {
+		t.Error("got no error for key 0")
+	}
+}
@@ -0,0 +1,231 @@
+package meta
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/server"
+)
+
+// NetworkConfig is the network platform config of Talos, stored as YAML
+// under the MetalNetworkPlatformConfig key. Field names follow Talos.
+type NetworkConfig struct {
+	Addresses   []Address    `json:"addresses"`
+	Links       []Link       `json:"links"`
+	Routes      []Route      `json:"routes"`
+	Hostnames   []Hostname   `json:"hostnames"`
+	Resolvers   []Resolver   `json:"resolvers"`
+	TimeServers []TimeServer `json:"timeServers"`
+}
+
+// Address is assigned to a link.
+type Address struct {
+	Address  string `json:"address"`
+	LinkName string `json:"linkName"`
+	Family   string `json:"family"`
+	Scope    string `json:"scope"`
+	Flags    string `json:"flags"`
+	Layer    string `json:"layer"`
+}
+
+// Link is a physical interface, or a logical one (bond or VLAN).
+type Link struct {
+	Name       string      `json:"name"`
+	Logical    bool        `json:"logical"`
+	Up         bool        `json:"up"`
+	MTU        int         `json:"mtu,omitempty"`
+	Kind       string      `json:"kind,omitempty"`
+	Type       string      `json:"type"`
+	ParentName string      `json:"parentName,omitempty"`
+	BondSlave  *BondSlave  `json:"bondSlave,omitempty"`
+	BondMaster *BondMaster `json:"bondMaster,omitempty"`
+	VLAN       *VLAN       `json:"vlan,omitempty"`
+	Layer      string      `json:"layer"`
+}
+
+// BondSlave ties a link to its bond.
+type BondSlave struct {
+	MasterName string `json:"masterName"`
+	SlaveIndex int    `json:"slaveIndex"`
+}
+
+// BondMaster holds the settings of a bond.
+type BondMaster struct {
+	Mode           string `json:"mode"`
+	XmitHashPolicy string `json:"xmitHashPolicy,omitempty"`
+	LACPRate       string `json:"lacpRate,omitempty"`
+	MIIMon         int    `json:"miimon,omitempty"`
+	UpDelay        int    `json:"updelay,omitempty"`
+	DownDelay      int    `json:"downdelay,omitempty"`
+}
+
+// VLAN holds the settings of a VLAN sub-interface.
+type VLAN struct {
+	VID      int    `json:"vlanID"`
+	Protocol string `json:"vlanProtocol"`
+}
+
+// Route is a static route.
+type Route struct {
+	Family      string `json:"family"`
+	Destination string `json:"dst"`
+	Gateway     string `json:"gateway,omitempty"`
+	OutLinkName string `json:"outLinkName"`
+	Table       string `json:"table"`
+	Priority    int    `json:"priority"`
+	Scope       string `json:"scope"`
+	Type        string `json:"type"`
+	Protocol    string `json:"protocol"`
+	Layer       string `json:"layer"`
+}
+
+// Hostname of the machine.
+type Hostname struct {
+	Hostname string `json:"hostname"`
+	Layer    string `json:"layer"`
+}
+
+// Resolver lists name servers.
+type Resolver struct {
+	DNSServers []string `json:"dnsServers"`
+	Layer      string   `json:"layer"`
+}
+
+// TimeServer lists NTP servers.
+type TimeServer struct {
+	TimeServers []string `json:"timeServers"`
+	Layer       string   `json:"layer"`
+}
+
+// layer of the network config in Talos.
+const layer = "platform"
+
+// YAML returns the config as YAML, in the JSON subset of it.
+func (c *NetworkConfig) YAML() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// NewNetworkConfig builds the network config of the machine as found by
+// the inventory: its uplink (links, bond and VLAN) under the interface
+// names of Talos, its IPv4 and IPv6 addresses, default routes (and an
+// on-link route to a gateway outside the IPv4 prefix) and hostname, and
+// the name and NTP servers given.
+func NewNetworkConfig(mach *server.Machine, nameServers, timeServers []string) (*NetworkConfig, error) {
+	c := &NetworkConfig{}
+	var iface string
+	if u := mach.Uplink; u != nil {
+		iface = u.TalosInterface()
+		c.Links = uplinkLinks(u)
+	} else if name := mach.Ethernet.IDNetNames.InterfaceName(); name != "" {
+		iface = name
+		c.Links = []Link{{Name: name, Up: true, Type: "ether", Layer: layer}}
+	} else {
+		return nil, fmt.Errorf("cannot determine name for ethernet interface")
+	}
+
+	if mach.IPv4Network.CIDR != "" && mach.IPv4Network.Gateway != "" {
+		ip, prefix, err := net.ParseCIDR(mach.IPv4Network.CIDR)
+		if err != nil {
+			return nil, err
+		}
+		c.Addresses = append(c.Addresses, Address{
+			Address: mach.IPv4Network.CIDR, LinkName: iface, Family: "inet4", Scope: "global", Flags: "permanent", Layer: layer,
+		})
+		gw := net.ParseIP(mach.IPv4Network.Gateway)
+		if gw == nil {
+			return nil, fmt.Errorf("invalid IPv4 gateway %q", mach.IPv4Network.Gateway)
+		}
+		if !prefix.Contains(gw) || ip.Equal(gw) {
+			// Like the /32 addresses of Hetzner Cloud
+			c.Routes = append(c.Routes, route("inet4", gw.String()+"/32", "", iface, "link"))
+		}
+		c.Routes = append(c.Routes, route("inet4", "", gw.String(), iface, "global"))
+	}
+	if mach.IPv6Network.CIDR != "" && mach.IPv6Network.Gateway != "" {
+		c.Addresses = append(c.Addresses, Address{
+			Address: mach.IPv6Network.CIDR, LinkName: iface, Family: "inet6", Scope: "global", Flags: "permanent", Layer: layer,
+		})
+		c.Routes = append(c.Routes, route("inet6", "", mach.IPv6Network.Gateway, iface, "global"))
+	}
+	if len(c.Addresses) == 0 {
+		return nil, fmt.Errorf("cannot determine IPv4 or IPv6 address and gateway for %s", iface)
+	}
+	if mach.Hostname != "" {
+		c.Hostnames = []Hostname{{Hostname: mach.Hostname, Layer: layer}}
+	}
+	if len(nameServers) > 0 {
+		c.Resolvers = []Resolver{{DNSServers: nameServers, Layer: layer}}
+	}
+	if len(timeServers) > 0 {
+		c.TimeServers = []TimeServer{{TimeServers: timeServers, Layer: layer}}
+	}
+	return c, nil
+}
+
+func route(family, dst, gateway, link, scope string) Route {
+	return Route{
+		Family:      family,
+		Destination: dst,
+		Gateway:     gateway,
+		OutLinkName: link,
+		Table:       "main",
+		Priority:    1024,
+		Scope:       scope,
+		Type:        "unicast",
+		Protocol:    "static",
+		Layer:       layer,
+	}
+}
+
+func uplinkLinks(u *server.Uplink) []Link {
+	var links []Link
+	parent := ""
+	for i, l := range u.Links {
+		link := Link{Name: l.TalosName(), Up: true, Type: "ether", Layer: layer}
+		if u.Bond != nil {
+			link.BondSlave = &BondSlave{MasterName: u.Bond.Name, SlaveIndex: i}
+		}
+		links = append(links, link)
+		parent = link.Name
+	}
+	if u.Bond != nil {
+		bond := &BondMaster{Mode: u.Bond.Mode}
+		for _, o := range u.Bond.Options {
+			k, v, _ := strings.Cut(o, "=")
+			n, _ := strconv.Atoi(v)
+			switch k {
+			case "xmit_hash_policy":
+				bond.XmitHashPolicy = v
+			case "lacp_rate":
+				bond.LACPRate = v
+			case "miimon":
+				bond.MIIMon = n
+			case "updelay":
+				bond.UpDelay = n
+			case "downdelay":
+				bond.DownDelay = n
+			}
+		}
+		links = append(links, Link{Name: u.Bond.Name, Logical: true, Up: true, Kind: "bond", Type: "ether", BondMaster: bond, Layer: layer})
+		parent = u.Bond.Name
+	}
+	if u.VLAN != nil {
+		links = append(links, Link{
+			Name:       u.TalosInterface(),
+			Logical:    true,
+			Up:         true,
+			Kind:       "vlan",
+			Type:       "ether",
+			ParentName: parent,
+			VLAN:       &VLAN{VID: u.VLAN.ID, Protocol: "802.1q"},
+			Layer:      layer,
+		})
+	}
+	if u.MTU > 0 && u.MTU != 1500 && len(links) > 0 {
+		links[len(links)-1].MTU = u.MTU
+	}
+	return links
+}
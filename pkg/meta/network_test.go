@@ -0,0 +1,79 @@
+package meta_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/meta"
+	"github.com/fabiant7t/totalos/pkg/server"
+)
+
+func TestNewNetworkConfig(t *testing.T) {
+	mach := &server.Machine{
+		Hostname: "talos-203-0-113-10",
+		IPv4Network: server.Network{
+			IP: "203.0.113.10", CIDR: "203.0.113.10/32", Gateway: "172.31.1.1",
+			ResolversV4: []string{"185.12.64.1"}, ResolversV6: []string{"2a01:4ff:ff00::add:1"},
+		},
+		IPv6Network: server.Network{IP: "2a01:4f8::2", CIDR: "2a01:4f8::2/64", Gateway: "fe80::1"},
+		Uplink: &server.Uplink{
+			Interface: "bond0.4000",
+			MTU:       1400,
+			VLAN:      &server.VLAN{ID: 4000, Parent: "bond0"},
+			Bond:      &server.Bond{Name: "bond0", Mode: "802.3ad", Options: []string{"xmit_hash_policy=layer3+4", "lacp_rate=fast", "miimon=100"}},
+			Links: []server.Link{
+				{Name: "eth0", IDNetNames: server.IDNetNames{Path: "enp1s0f0"}},
+				{Name: "eth1", IDNetNames: server.IDNetNames{Path: "enp1s0f1"}},
+			},
+		},
+	}
+	c, err := meta.NewNetworkConfig(mach, []string{"185.12.64.1", "2a01:4ff:ff00::add:1"}, []string{"162.159.200.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, have any
+	wantJSON := `{
+	  "addresses": [
+	    {"address": "203.0.113.10/32", "linkName": "bond0.4000", "family": "inet4", "scope": "global", "flags": "permanent", "layer": "platform"},
+	    {"address": "2a01:4f8::2/64", "linkName": "bond0.4000", "family": "inet6", "scope": "global", "flags": "permanent", "layer": "platform"}
+	  ],
+	  "links": [
+	    {"name": "enp1s0f0", "logical": false, "up": true, "type": "ether", "bondSlave": {"masterName": "bond0", "slaveIndex": 0}, "layer": "platform"},
+	    {"name": "enp1s0f1", "logical": false, "up": true, "type": "ether", "bondSlave": {"masterName": "bond0", "slaveIndex": 1}, "layer": "platform"},
+	    {"name": "bond0", "logical": true, "up": true, "kind": "bond", "type": "ether",
+	     "bondMaster": {"mode": "802.3ad", "xmitHashPolicy": "layer3+4", "lacpRate": "fast", "miimon": 100}, "layer": "platform"},
+	    {"name": "bond0.4000", "logical": true, "up": true, "mtu": 1400, "kind": "vlan", "type": "ether", "parentName": "bond0",
+	     "vlan": {"vlanID": 4000, "vlanProtocol": "802.1q"}, "layer": "platform"}
+	  ],
+	  "routes": [
+	    {"family": "inet4", "dst": "172.31.1.1/32", "outLinkName": "bond0.4000", "table": "main", "priority": 1024, "scope": "link", "type": "unicast", "protocol": "static", "layer": "platform"},
+	    {"family": "inet4", "dst": "", "gateway": "172.31.1.1", "outLinkName": "bond0.4000", "table": "main", "priority": 1024, "scope": "global", "type": "unicast", "protocol": "static", "layer": "platform"},
+	    {"family": "inet6", "dst": "", "gateway": "fe80::1", "outLinkName": "bond0.4000", "table": "main", "priority": 1024, "scope": "global", "type": "unicast", "protocol": "static", "layer": "platform"}
+	  ],
+	  "hostnames": [{"hostname": "talos-203-0-113-10", "layer": "platform"}],
+	  "resolvers": [{"dnsServers": ["185.12.64.1", "2a01:4ff:ff00::add:1"], "layer": "platform"}],
+	  "timeServers": [{"timeServers": ["162.159.200.1"], "layer": "platform"}]
+	}`
+	if err := json.Unmarshal([]byte(wantJSON), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(got, &have); err != nil {
+		t.Fatal(err)
+	}
+	haveJSON, _ := json.Marshal(have)
+	wantNorm, _ := json.Marshal(want)
+	if string(haveJSON) != string(wantNorm) {
+		t.Errorf("got %s, want %s", haveJSON, wantNorm)
+	}
+}
+
+func TestNewNetworkConfigWithoutAddresses(t *testing.T) {
+	mach := &server.Machine{Ethernet: server.Ethernet{IDNetNames: server.IDNetNames{Path: "enp1s0"}}}
+	if _, err := meta.NewNetworkConfig(mach, nil, nil); err == nil {
+		t.Error("got no error")
+	}
+}
@@ -0,0 +1,177 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/boot"
+	"github.com/fabiant7t/totalos/pkg/installation"
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// ukiHeadSize is read of every unified kernel image to locate its
+// sections, the PE headers fit into it many times over.
+const ukiHeadSize = 64 << 10
+
+// BootInfo mounts the EFI system partition and the boot partition of the
+// device read-only and tells how the written Talos image boots: the
+// bootloader, the Talos version and the kernel arguments of its default
+// entry (grub menu entry or unified kernel image), as well as the
+// firmware mode of the machine. Images without these partitions (like
+// ISOs) yield the firmware mode only.
+func BootInfo(m remotecommand.Machine, device string, cb ssh.HostKeyCallback) (*installation.Boot, error) {
+	parts, err := SystemPartitions(m, device, cb)
+	if err != nil {
+		return nil, err
+	}
+	efiPart, bootPart := parts.EFI, parts.Boot
+	cmd := fmt.Sprintf(`
+    efi=$(mktemp -d)
+    boot=$(mktemp -d)
+    trap 'umount "$efi" "$boot" 2> /dev/null; rmdir "$efi" "$boot"' EXIT
+    if [ -d /sys/firmware/efi ]; then echo "mode uefi"; else echo "mode bios"; fi
+    if [ -n %[1]s ] && mount -o ro %[1]s "$boot" 2> /dev/null && [ -f "$boot/grub/grub.cfg" ]; then
+      echo "grub $(base64 -w 0 < "$boot/grub/grub.cfg")"
+    fi
+    if [ -n %[2]s ] && mount -o ro %[2]s "$efi" 2> /dev/null; then
+      [ -f "$efi/loader/loader.conf" ] && echo "loader $(base64 -w 0 < "$efi/loader/loader.conf")"
+      for f in "$efi"/EFI/Linux/*.efi; do
+        [ -f "$f" ] && echo "uki $(basename "$f") $(head -c %[3]d "$f" | base64 -w 0)"
+      done
+    fi
+    true
+  `, shellQuote(bootPart), shellQuote(efiPart), ukiHeadSize)
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command BootInfo failed: %w", err)
+	}
+	info, err := parseBootInfo(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command BootInfo failed: %w", err)
+	}
+	if info.uki == "" {
+		return info.boot, nil
+	}
+
+	// Read the sections of the default unified kernel image
+	sections, err := boot.UKISections(info.ukiHeads[info.uki])
+	if err != nil {
+		return nil, fmt.Errorf("Remote command BootInfo failed: %s: %w", info.uki, err)
+	}
+	var script strings.Builder
+	fmt.Fprintf(&script, `
+    efi=$(mktemp -d)
+    trap 'umount "$efi" 2> /dev/null; rmdir "$efi"' EXIT
+    mount -o ro %s "$efi" || exit 1
+  `, shellQuote(efiPart))
+	for _, name := range []string{".osrel", ".cmdline"} {
+		if s, ok := sections[name]; ok {
+			fmt.Fprintf(&script, `
+    echo "%s $(tail -c +%d "$efi"/EFI/Linux/%s | head -c %d | base64 -w 0)"
+  `, name, s.Offset+1, shellQuote(info.uki), s.Size)
+		}
+	}
+	stdout, err = remotecommand.Command(m, script.String(), cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command BootInfo failed: %w", err)
+	}
+	for _, line := range strings.Split(string(stdout), "\n") {
+		name, encoded, _ := strings.Cut(strings.TrimSpace(line), " ")
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case ".osrel":
+			osrel := boot.ParseOSRelease(data)
+			if v := osrel["VERSION_ID"]; v != "" {
+				info.boot.TalosVersion = v
+			} else if v := boot.Version(osrel["PRETTY_NAME"]); v != "" {
+				info.boot.TalosVersion = v
+			}
+		case ".cmdline":
+			info.boot.KernelArgs = boot.ParseCmdline(data)
+		}
+	}
+	return info.boot, nil
+}
+
+type bootInfo struct {
+	boot *installation.Boot
+	// uki is the file name of the default unified kernel image, if any.
+	uki      string
+	ukiHeads map[string][]byte
+}
+
+// parseBootInfo parses the lines of "key value..." the first BootInfo
+// script prints. Unified kernel images win over grub, unless booting by
+// BIOS.
+func parseBootInfo(stdout []byte) (*bootInfo, error) {
+	info := &bootInfo{boot: &installation.Boot{}, ukiHeads: make(map[string][]byte)}
+	var grubCfg, loaderConf []byte
+	s := bufio.NewScanner(bytes.NewReader(stdout))
+	s.Buffer(nil, 4*ukiHeadSize)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "mode":
+			info.boot.Mode = fields[1]
+		case "grub":
+			grubCfg, err = base64.StdEncoding.DecodeString(fields[1])
+		case "loader":
+			loaderConf, err = base64.StdEncoding.DecodeString(fields[1])
+		case "uki":
+			if len(fields) == 3 {
+				info.ukiHeads[fields[1]], err = base64.StdEncoding.DecodeString(fields[2])
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	// BIOS firmware boots dual-boot images through grub
+	if len(info.ukiHeads) > 0 && (info.boot.Mode != "bios" || grubCfg == nil) {
+		info.boot.Bootloader = "systemd-boot"
+		names := make([]string, 0, len(info.ukiHeads))
+		for name := range info.ukiHeads {
+			names = append(names, name)
+		}
+		slices.SortFunc(names, boot.CompareUKIs)
+		// Like systemd-boot, pick the default or else the latest image
+		info.uki = names[len(names)-1]
+		if pattern := boot.LoaderDefault(loaderConf); pattern != "" {
+			for i := len(names) - 1; i >= 0; i-- {
+				if ok, _ := path.Match(pattern, names[i]); ok {
+					info.uki = names[i]
+					break
+				}
+			}
+		}
+		info.boot.Entry = info.uki
+		info.boot.TalosVersion = boot.Version(info.uki)
+		return info, nil
+	}
+	if grubCfg != nil {
+		info.boot.Bootloader = "grub"
+		if e := boot.ParseGrubConfig(grubCfg).DefaultEntry(); e != nil {
+			info.boot.Entry = e.Title
+			info.boot.TalosVersion = boot.Version(e.Title)
+			info.boot.KernelArgs = e.Args
+		}
+	}
+	return info, nil
+}
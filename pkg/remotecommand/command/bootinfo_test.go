@@ -0,0 +1,54 @@
+package command
+
+import (
+	"encoding/base64"
+	"slices"
+	"testing"
+)
+
+func TestParseBootInfo(t *testing.T) {
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	grubCfg := "set default=\"A - v1.9.5\"\nmenuentry \"A - v1.9.5\" {\n  linux /A/vmlinuz talos.platform=metal console=tty0\n  initrd /A/initramfs.xz\n}\n"
+
+	info, err := parseBootInfo([]byte("mode bios\ngrub " + b64(grubCfg) + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.uki != "" || info.boot.Mode != "bios" || info.boot.Bootloader != "grub" || info.boot.TalosVersion != "v1.9.5" || info.boot.Entry != "A - v1.9.5" {
+		t.Errorf("got %+v", info.boot)
+	}
+	if want := []string{"talos.platform=metal", "console=tty0"}; !slices.Equal(info.boot.KernelArgs, want) {
+		t.Errorf("got kernel args %q, want %q", info.boot.KernelArgs, want)
+	}
+
+	stdout := "mode uefi\n" +
+		"loader " + b64("default Talos-v1.11.*.efi\n") + "\n" +
+		"uki Talos-v1.11.2.efi " + b64("MZ") + "\n" +
+		"uki Talos-v1.11.3.efi " + b64("MZ") + "\n" +
+		"uki Talos-v1.11.10.efi " + b64("MZ") + "\n" +
+		"uki Talos-v1.12.0-beta.0.efi " + b64("MZ") + "\n"
+	info, err = parseBootInfo([]byte(stdout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.uki != "Talos-v1.11.10.efi" || info.boot.Mode != "uefi" || info.boot.Bootloader != "systemd-boot" || info.boot.TalosVersion != "v1.11.10" {
+		t.Errorf("got %+v (uki %s)", info.boot, info.uki)
+	}
+
+	// Dual-boot images boot through grub by BIOS
+	info, err = parseBootInfo([]byte("mode bios\ngrub " + b64(grubCfg) + "\nuki Talos-v1.11.3.efi " + b64("MZ") + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.uki != "" || info.boot.Bootloader != "grub" {
+		t.Errorf("got %+v (uki %s) for a dual-boot image by BIOS", info.boot, info.uki)
+	}
+
+	info, err = parseBootInfo([]byte("mode uefi\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.boot.Bootloader != "" || info.uki != "" {
+		t.Errorf("got %+v for an image without boot partitions", info.boot)
+	}
+}
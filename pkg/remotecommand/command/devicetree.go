@@ -0,0 +1,41 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// DeviceTree returns the board model and compatible strings of the
+// device tree, empty on machines without one (like x86 servers).
+func DeviceTree(m remotecommand.Machine, cb ssh.HostKeyCallback) (string, []string, error) {
+	cmd := `
+    [ -r /proc/device-tree/model ] && echo "model $(tr -d '\0' < /proc/device-tree/model)"
+    [ -r /proc/device-tree/compatible ] && tr '\0' '\n' < /proc/device-tree/compatible | sed 's/^/compatible /'
+    true
+  `
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return "", nil, fmt.Errorf("Remote command DeviceTree failed: %w", err)
+	}
+	model, compatible := parseDeviceTree(stdout)
+	return model, compatible, nil
+}
+
+func parseDeviceTree(stdout []byte) (string, []string) {
+	var model string
+	var compatible []string
+	for _, line := range strings.Split(string(stdout), "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch value = strings.TrimSpace(value); {
+		case value == "":
+		case key == "model":
+			model = value
+		case key == "compatible":
+			compatible = append(compatible, value)
+		}
+	}
+	return model, compatible
+}
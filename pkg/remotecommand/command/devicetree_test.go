@@ -0,0 +1,20 @@
+package command
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseDeviceTree(t *testing.T) {
+	stdout := []byte("model Raspberry Pi 4 Model B Rev 1.5\ncompatible raspberrypi,4-model-b\ncompatible brcm,bcm2711\n")
+	model, compatible := parseDeviceTree(stdout)
+	if model != "Raspberry Pi 4 Model B Rev 1.5" {
+		t.Errorf("got model %q", model)
+	}
+	if want := []string{"raspberrypi,4-model-b", "brcm,bcm2711"}; !slices.Equal(compatible, want) {
+		t.Errorf("got compatible %q, want %q", compatible, want)
+	}
+	if model, compatible := parseDeviceTree(nil); model != "" || compatible != nil {
+		t.Errorf("got %q, %q without device tree", model, compatible)
+	}
+}
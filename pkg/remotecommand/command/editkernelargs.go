@@ -0,0 +1,74 @@
+package command
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/fabiant7t/totalos/pkg/boot"
+	"github.com/fabiant7t/totalos/pkg/kernel"
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrNoGrubConfig tells that the image has no grub.cfg to edit.
+var ErrNoGrubConfig = errors.New("no grub.cfg, the image boots unified kernel images through systemd-boot")
+
+// EditKernelArgs applies the edit to the kernel command line of every
+// menu entry of grub.cfg on the boot partition of the device, and
+// returns the arguments of the default entry. grub.cfg is replaced in one
+// go (by rename), and only if it has not changed since it was read.
+// grub.cfg.orig keeps it as written by the image, from the first edit
+// on. Applying an edit again changes nothing. Images without grub.cfg
+// (booting unified kernel images through systemd-boot only) yield
+// ErrNoGrubConfig.
+func EditKernelArgs(m remotecommand.Machine, device string, edit *kernel.Edit, cb ssh.HostKeyCallback) (kernel.Cmdline, error) {
+	parts, err := SystemPartitions(m, device, cb)
+	if err != nil {
+		return nil, err
+	}
+	if parts.Boot == "" && parts.EFI != "" {
+		return nil, fmt.Errorf("Remote command EditKernelArgs failed: %w", ErrNoGrubConfig)
+	}
+	part, err := parts.RequireBoot()
+	if err != nil {
+		return nil, fmt.Errorf("Remote command EditKernelArgs failed: %w", err)
+	}
+	cmd := fmt.Sprintf(`
+    boot=$(mktemp -d)
+    trap 'umount "$boot" 2> /dev/null; rmdir "$boot"' EXIT
+    mount -o ro %s "$boot" || exit 1
+    [ ! -f "$boot/grub/grub.cfg" ] || cat "$boot/grub/grub.cfg"
+  `, shellQuote(part))
+	cfg, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command EditKernelArgs failed: %w", err)
+	}
+	if len(bytes.TrimSpace(cfg)) == 0 {
+		return nil, fmt.Errorf("Remote command EditKernelArgs failed: %w", ErrNoGrubConfig)
+	}
+	edited := boot.EditGrubKernelArgs(cfg, edit)
+	entry := boot.ParseGrubConfig(edited).DefaultEntry()
+	if entry == nil {
+		return nil, fmt.Errorf("Remote command EditKernelArgs failed: no menu entry in grub.cfg of %s", part)
+	}
+	if bytes.Equal(edited, cfg) {
+		return kernel.Cmdline(entry.Args), nil
+	}
+	sum := sha256.Sum256(cfg)
+	cmd = fmt.Sprintf(`
+    boot=$(mktemp -d)
+    trap 'cd /; umount "$boot" 2> /dev/null; rmdir "$boot"' EXIT
+    mount %s "$boot" || exit 1
+    cd "$boot/grub" || exit 1
+    [ "$(sha256sum < grub.cfg | cut -d ' ' -f 1)" = %s ] || { echo "grub.cfg changed while being edited" >&2; exit 1; }
+    [ -f grub.cfg.orig ] || cp grub.cfg grub.cfg.orig || exit 1
+    cat > grub.cfg.new && sync && mv grub.cfg.new grub.cfg && sync
+  `, shellQuote(part), hex.EncodeToString(sum[:]))
+	if err := remotecommand.Run(m, cmd, bytes.NewReader(edited), &bytes.Buffer{}, cb); err != nil {
+		return nil, fmt.Errorf("Remote command EditKernelArgs failed: %w", err)
+	}
+	return kernel.Cmdline(entry.Args), nil
+}
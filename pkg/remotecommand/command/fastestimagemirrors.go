@@ -0,0 +1,78 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// mirrorProbeBytes is the amount of data downloaded from every mirror
+const mirrorProbeBytes = 1 << 20
+
+// FastestImageMirrors downloads the first MiB from each of the URLs on
+// the rescue system and returns the reachable ones, fastest first.
+func FastestImageMirrors(m remotecommand.Machine, urls []string, cb ssh.HostKeyCallback) ([]string, error) {
+	var b strings.Builder
+	for _, url := range urls {
+		fmt.Fprintf(&b, `
+    start=$(date +%%s%%N)
+    n=$(wget -q -t 1 -T 10 -O - %s 2> /dev/null | head -c %d | wc -c)
+    echo "$n $(($(date +%%s%%N) - start))"
+    `, shellQuote(url), mirrorProbeBytes)
+	}
+	stdout, err := remotecommand.Command(m, b.String(), cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command FastestImageMirrors failed: %w", err)
+	}
+	fastest, err := parseMirrorProbes(urls, stdout)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command FastestImageMirrors failed: %w", err)
+	}
+	return fastest, nil
+}
+
+// stdout contains a line "<bytes> <nanoseconds>" per URL
+func parseMirrorProbes(urls []string, stdout []byte) ([]string, error) {
+	type probe struct {
+		url  string
+		rate float64
+	}
+	var probes []probe
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for i := 0; scanner.Scan() && i < len(urls); i++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		n, err1 := strconv.ParseInt(fields[0], 10, 64)
+		ns, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil || n == 0 || ns <= 0 {
+			continue // unreachable
+		}
+		probes = append(probes, probe{urls[i], float64(n) / float64(ns)})
+	}
+	if len(probes) == 0 {
+		return nil, errors.New("no image mirror is reachable")
+	}
+	slices.SortStableFunc(probes, func(a, b probe) int {
+		switch {
+		case a.rate > b.rate:
+			return -1
+		case a.rate < b.rate:
+			return 1
+		}
+		return 0
+	})
+	fastest := make([]string, len(probes))
+	for i, p := range probes {
+		fastest[i] = p.url
+	}
+	return fastest, nil
+}
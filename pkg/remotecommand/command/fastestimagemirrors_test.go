@@ -0,0 +1,22 @@
+package command
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFastestImageMirrors_parseMirrorProbes(t *testing.T) {
+	urls := []string{"https://a", "https://b", "https://c", "https://d"}
+	stdout := []byte("1048576 2000000000\n0 10000000000\n1048576 500000000\n524288 500000000\n")
+	want := []string{"https://c", "https://d", "https://a"}
+	got, err := parseMirrorProbes(urls, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+	if _, err := parseMirrorProbes(urls[:1], []byte("0 10000000000\n")); err == nil {
+		t.Error("Got no error without reachable mirrors")
+	}
+}
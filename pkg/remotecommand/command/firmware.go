@@ -0,0 +1,53 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"github.com/fabiant7t/totalos/pkg/server"
+	"golang.org/x/crypto/ssh"
+)
+
+// efiGlobalVariable is the vendor GUID of the UEFI global variables.
+const efiGlobalVariable = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+// Firmware tells whether the machine booted the rescue system in UEFI or
+// legacy BIOS mode, and reads the SecureBoot and SetupMode variables of
+// UEFI firmware. Each efivars file holds 4 bytes of attributes followed
+// by the value, a single byte for both.
+func Firmware(m remotecommand.Machine, cb ssh.HostKeyCallback) (server.Firmware, error) {
+	cmd := fmt.Sprintf(`
+    if [ ! -d /sys/firmware/efi ]; then echo "mode bios"; exit 0; fi
+    echo "mode uefi"
+    for name in SecureBoot SetupMode; do
+      f=/sys/firmware/efi/efivars/$name-%s
+      [ -r "$f" ] && echo "$name $(od -An -tu1 -j4 -N1 "$f")"
+    done
+    true
+  `, efiGlobalVariable)
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return server.Firmware{}, fmt.Errorf("Remote command Firmware failed: %w", err)
+	}
+	return parseFirmware(stdout), nil
+}
+
+func parseFirmware(stdout []byte) server.Firmware {
+	var fw server.Firmware
+	for _, line := range strings.Split(string(stdout), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "mode":
+			fw.Mode = fields[1]
+		case "SecureBoot":
+			fw.SecureBoot = fields[1] == "1"
+		case "SetupMode":
+			fw.SetupMode = fields[1] == "1"
+		}
+	}
+	return fw
+}
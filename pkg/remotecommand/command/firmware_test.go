@@ -0,0 +1,24 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/server"
+)
+
+func TestParseFirmware(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stdout string
+		want   server.Firmware
+	}{
+		{"legacy bios", "mode bios\n", server.Firmware{Mode: "bios"}},
+		{"uefi without efivars", "mode uefi\n", server.Firmware{Mode: "uefi"}},
+		{"secure boot enforced", "mode uefi\nSecureBoot    1\nSetupMode    0\n", server.Firmware{Mode: "uefi", SecureBoot: true}},
+		{"setup mode", "mode uefi\nSecureBoot    0\nSetupMode    1\n", server.Firmware{Mode: "uefi", SetupMode: true}},
+	} {
+		if got := parseFirmware([]byte(tc.stdout)); got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
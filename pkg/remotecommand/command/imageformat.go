@@ -0,0 +1,44 @@
+package command
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// ImageFormat downloads the leading bytes of the image from the rescue
+// system and detects the image format by its content. The Content-Type
+// response header and the URL are taken into account as well. Headers
+// are sent with the request, like "Authorization: Bearer ...".
+func ImageFormat(m remotecommand.Machine, imageURL string, headers []string, cb ssh.HostKeyCallback) (image.Format, error) {
+	var headerArgs strings.Builder
+	for _, h := range headers {
+		headerArgs.WriteString(" --header " + shellQuote(h))
+	}
+	cmd := fmt.Sprintf(`
+    wget -S%s -O - %s 2>/tmp/totalos-headers \
+    | head -c %d \
+    | base64 -w 0; \
+    echo; \
+    awk 'tolower($1) == "content-type:" {print $2}' /tmp/totalos-headers | tail -n 1; \
+    rm -f /tmp/totalos-headers
+  `, headerArgs.String(), shellQuote(imageURL), image.SniffLength)
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return "", fmt.Errorf("Remote command ImageFormat failed: %w", err)
+	}
+	encoded, contentType, _ := bytes.Cut(stdout, []byte("\n"))
+	head, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return "", fmt.Errorf("Remote command ImageFormat failed: %w", err)
+	}
+	if len(head) == 0 {
+		return "", fmt.Errorf("Remote command ImageFormat failed: cannot download %s", imageURL)
+	}
+	return image.DetectFormat(head, string(bytes.TrimSpace(contentType)), imageURL)
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// ImageHeadSize is the leading region of the system disk compared to
+// tell whether an image has been installed already. On Talos images it
+// covers the partition table (first MiB) and the leading 31 MiB of the
+// EFI system partition, which starts at 1 MiB and spans about 100 MiB.
+// Nothing within it is changed after the write: grub.cfg is modified on
+// the boot partition, and the install record is kept on the boot
+// partition or, without one, in the META partition, all of which come
+// after it.
+const ImageHeadSize = 32 << 20
+
+// ImageHeadSHA256 downloads and decompresses the leading ImageHeadSize
+// bytes of the image on the rescue system and returns their SHA-256 and
+// length (shorter for smaller images). Of the options, Headers and
+// Source are taken into account. Only the leading ImageHeadSize bytes
+// of Source are being read.
+func ImageHeadSHA256(m remotecommand.Machine, imageURL string, format image.Format, opts *InstallOptions, cb ssh.HostKeyCallback) (*InstallResult, error) {
+	if opts == nil {
+		opts = &InstallOptions{}
+	}
+	cmd, err := imageHeadScript(imageURL, format, opts)
+	if err != nil {
+		return nil, err
+	}
+	var stdin io.Reader
+	if opts.Source != nil {
+		// Images compress, the compressed head is shorter than the raw one
+		stdin = io.LimitReader(opts.Source, ImageHeadSize)
+	}
+	var out installOutput
+	if err := remotecommand.Run(m, cmd, stdin, &lineWriter{fn: out.line}, cb); err != nil {
+		return nil, fmt.Errorf("Remote command ImageHeadSHA256 failed: %w", err)
+	}
+	res, err := out.result()
+	if err != nil {
+		return nil, fmt.Errorf("Remote command ImageHeadSHA256 failed: %w", err)
+	}
+	return res, nil
+}
+
+func imageHeadScript(imageURL string, format image.Format, opts *InstallOptions) (string, error) {
+	decompressor, ok := Decompressors[format]
+	if !ok {
+		return "", fmt.Errorf("ImageHeadSHA256 cannot handle %s images", format)
+	}
+	var b strings.Builder
+	err := imageHeadTemplate.Execute(&b, map[string]any{
+		"URL":          imageURL,
+		"Headers":      opts.Headers,
+		"Stdin":        opts.Source != nil,
+		"Decompressor": decompressor,
+		"Size":         ImageHeadSize,
+	})
+	return b.String(), err
+}
+
+// The decompressor fails on the truncated stream (stdin), or the
+// download is killed once head has read enough. Only what made it
+// through counts.
+var imageHeadTemplate = template.Must(template.New("head").Funcs(template.FuncMap{
+	"quote": shellQuote,
+}).Parse(`
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+{{- if .Stdin}}
+head -c {{.Size}} \
+{{- else}}
+wget -q -O -{{range .Headers}} --header {{quote .}}{{end}} {{quote .URL}} \
+{{- end}}
+| { {{.Decompressor}} 2> /dev/null; } \
+| head -c {{.Size}} \
+| dd bs=64k 2> "$tmp/count" \
+| sha256sum > "$tmp/sha256"
+echo "bytes $(awk '/bytes/ {n = $1} END {print n + 0}' "$tmp/count")"
+echo "sha256 $(cut -d ' ' -f 1 "$tmp/sha256")"
+`))
@@ -0,0 +1,74 @@
+package command
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+// TestImageHeadScript runs the remote script locally, downloading the
+// image and reading it from stdin.
+func TestImageHeadScript(t *testing.T) {
+	for _, bin := range []string{"sh", "wget", "gzip", "dd", "sha256sum"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is not available", bin)
+		}
+	}
+	raw := make([]byte, ImageHeadSize+1<<20)
+	rand.New(rand.NewSource(1)).Read(raw[:1<<20]) // zeros compress like the rest of a disk image
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(raw)
+	zw.Close()
+	headSum := sha256.Sum256(raw[:ImageHeadSize])
+	want := InstallResult{Bytes: ImageHeadSize, SHA256: hex.EncodeToString(headSum[:])}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(compressed.Bytes()))
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name string
+		url  string
+		opts *InstallOptions
+	}{
+		{"download", srv.URL + "/image", &InstallOptions{Headers: []string{"Authorization: Bearer t0k"}}},
+		{"stdin", "", &InstallOptions{Source: bytes.NewReader(compressed.Bytes())}},
+	} {
+		script, err := imageHeadScript(tc.url, image.FormatGzip, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", script)
+		if tc.opts.Source != nil {
+			cmd.Stdin = io.LimitReader(tc.opts.Source, ImageHeadSize)
+		}
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("%s: script failed: %v\n%s", tc.name, err, stderr.String())
+		}
+		got, err := parseInstallResult(stdout.Bytes(), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if *got != want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fabiant7t/totalos/pkg/meta"
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// installedImagePath is where the record is kept on the boot partition.
+const installedImagePath = "/mnt/totalos/image.json"
+
+// InstalledImage records an image that has been written to the system
+// disk completely. It is kept on the boot partition, or as a META key on
+// images without one. Either comes after ImageHeadSize.
+type InstalledImage struct {
+	Image       string `json:"image"`
+	ImageSHA256 string `json:"image_sha256,omitempty"`
+	// Bytes of the decompressed image.
+	Bytes int64 `json:"bytes"`
+	// HeadBytes and HeadSHA256 describe the leading region of the disk
+	// right after the write, see ImageHeadSize.
+	HeadBytes  int64     `json:"head_bytes"`
+	HeadSHA256 string    `json:"head_sha256"`
+	Installed  time.Time `json:"installed"`
+}
+
+// ReadInstalledImage returns the record of the image installed on the
+// device, or nil if there is none (like on a wiped disk).
+func ReadInstalledImage(m remotecommand.Machine, device string, cb ssh.HostKeyCallback) (*InstalledImage, error) {
+	parts, err := SystemPartitions(m, device, cb)
+	if err != nil {
+		return nil, err
+	}
+	part, inMeta := parts.recordPartition()
+	if part == "" {
+		return nil, nil
+	}
+	if inMeta {
+		cmd := fmt.Sprintf(`head -c %d %s`, 2*meta.Length, shellQuote(part))
+		stdout, err := remotecommand.Command(m, cmd, cb)
+		if err != nil {
+			return nil, fmt.Errorf("Remote command ReadInstalledImage failed: %w", err)
+		}
+		return installedImageFromMeta(stdout), nil
+	}
+	cmd := fmt.Sprintf(`
+    mount -o ro %s /mnt 2> /dev/null || exit 0
+    cat %s 2> /dev/null
+    umount /mnt
+  `, shellQuote(part), installedImagePath)
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command ReadInstalledImage failed: %w", err)
+	}
+	return parseInstalledImage(stdout), nil
+}
+
+// parseInstalledImage returns nil for anything but a complete record,
+// a foreign or broken file is no record.
+func parseInstalledImage(stdout []byte) *InstalledImage {
+	var rec InstalledImage
+	if err := json.Unmarshal(bytes.TrimSpace(stdout), &rec); err != nil {
+		return nil
+	}
+	if rec.HeadSHA256 == "" || rec.HeadBytes == 0 {
+		return nil
+	}
+	return &rec
+}
+
+// installedImageFromMeta returns the record kept in the META data, or
+// nil if there is none.
+func installedImageFromMeta(b []byte) *InstalledImage {
+	values, err := meta.Unmarshal(b)
+	if err != nil {
+		return nil
+	}
+	return parseInstalledImage(values[meta.InstalledImage])
+}
+
+// recordPartition is the partition keeping the record, and whether it
+// is the META partition. The EFI system partition of images without a
+// boot partition lies within ImageHeadSize, so it is never used.
+func (p *Partitions) recordPartition() (string, bool) {
+	if p.Boot != "" {
+		return p.Boot, false
+	}
+	return p.Meta, p.Meta != ""
+}
+
+// WriteInstalledImage keeps the record on the boot partition (or META
+// partition) of the device, for ReadInstalledImage of later runs.
+func WriteInstalledImage(m remotecommand.Machine, device string, rec *InstalledImage, cb ssh.HostKeyCallback) error {
+	parts, err := SystemPartitions(m, device, cb)
+	if err != nil {
+		return err
+	}
+	part, inMeta := parts.recordPartition()
+	if part == "" {
+		return fmt.Errorf("Remote command WriteInstalledImage failed: %w", parts.missing("BOOT or META"))
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if inMeta {
+		return WriteMetaKey(m, device, meta.InstalledImage, b, cb)
+	}
+	cmd := fmt.Sprintf(`
+    mount %s /mnt \
+    && mkdir -p /mnt/totalos \
+    && printf '%%s\n' %s > %s \
+    && umount /mnt
+  `, shellQuote(part), shellQuote(string(b)), installedImagePath)
+	if _, err := remotecommand.Command(m, cmd, cb); err != nil {
+		return fmt.Errorf("Remote command WriteInstalledImage failed: %w", err)
+	}
+	return nil
+}
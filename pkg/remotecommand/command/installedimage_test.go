@@ -0,0 +1,58 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/meta"
+)
+
+func TestParseInstalledImage(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stdout string
+		want   bool
+	}{
+		{"no boot partition", "", false},
+		{"record", `{"image": "https://example.com/metal-amd64.raw.zst", "bytes": 1306525696, "head_bytes": 33554432, "head_sha256": "abc"}` + "\n", true},
+		{"foreign file", "not json", false},
+		{"incomplete record", `{"image": "https://example.com/metal-amd64.raw.zst"}`, false},
+	} {
+		got := parseInstalledImage([]byte(tc.stdout))
+		if (got != nil) != tc.want {
+			t.Errorf("%s: got %+v, want record %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestInstalledImageFromMeta(t *testing.T) {
+	record := []byte(`{"image": "https://example.com/metal-amd64-uki.raw.zst", "bytes": 1306525696, "head_bytes": 33554432, "head_sha256": "abc"}`)
+	b, err := meta.Meta{meta.MetalNetworkPlatformConfig: []byte("addresses: []\n"), meta.InstalledImage: record}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := installedImageFromMeta(b); got == nil || got.HeadSHA256 != "abc" {
+		t.Errorf("got %+v", got)
+	}
+	if got := installedImageFromMeta(make([]byte, 2*meta.Length)); got != nil {
+		t.Errorf("got %+v from a zeroed META partition", got)
+	}
+}
+
+func TestRecordPartition(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		parts      Partitions
+		want       string
+		wantInMeta bool
+	}{
+		{"grub image", Partitions{EFI: "/dev/sda1", BIOS: "/dev/sda2", Boot: "/dev/sda3", Meta: "/dev/sda4"}, "/dev/sda3", false},
+		// The EFI system partition lies within the image head
+		{"systemd-boot image without boot partition", Partitions{EFI: "/dev/sda1", Meta: "/dev/sda2"}, "/dev/sda2", true},
+		{"efi partition only", Partitions{EFI: "/dev/sda1"}, "", false},
+	} {
+		got, inMeta := tc.parts.recordPartition()
+		if got != tc.want || inMeta != tc.wantInMeta {
+			t.Errorf("%s: got %q, %t, want %q, %t", tc.name, got, inMeta, tc.want, tc.wantInMeta)
+		}
+	}
+}
@@ -1,69 +1,407 @@
 package command
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"net/url"
-	"path/filepath"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
 
+	"github.com/fabiant7t/totalos/pkg/image"
 	"github.com/fabiant7t/totalos/pkg/remotecommand"
 	"golang.org/x/crypto/ssh"
 )
 
-// InstallRawImage downloads the raw image URL and writes it to the given device.
-func InstallRawImage(m remotecommand.Machine, imageURL, device string, cb ssh.HostKeyCallback) error {
-	parsedURL, err := url.Parse(imageURL)
+// Decompressors maps each image format to the remote command turning
+// the downloaded data (stdin) into raw disk data (stdout). Supporting
+// another format means adding it here and to image.DetectFormat.
+var Decompressors = map[image.Format]string{
+	image.FormatRaw:   "cat",
+	image.FormatISO:   "cat",
+	image.FormatXZ:    "xz -dc",
+	image.FormatZstd:  "zstd -dc",
+	image.FormatGzip:  "gzip -dc",
+	image.FormatBzip2: "bzip2 -dc",
+	image.FormatLZ4:   "lz4 -dc",
+}
+
+// InstallOptions tune how InstallRawImage gets the image onto the disk.
+type InstallOptions struct {
+	// Retries is the number of times a broken download is being resumed
+	// with a HTTP range request. Defaults to 5 per URL.
+	Retries int
+	// Mirrors serve the same image as the image URL. A broken download
+	// is resumed from the next mirror.
+	Mirrors []string
+	// SHA256 is the expected hash of the download (as served, before
+	// decompression). Mismatches fail the installation.
+	SHA256 string
+	// CacheDir is a directory on the rescue system the compressed image
+	// is being downloaded to and reused from by later runs. The image is
+	// streamed to the disk without touching the rescue system's (often
+	// RAM backed) file systems when empty.
+	CacheDir string
+	// Verify hashes the decompressed image stream while it is being
+	// written, see ReadBackSHA256.
+	Verify bool
+	// Progress is called about once a second while the image is being
+	// downloaded and written.
+	Progress func(Progress)
+	// Headers are sent with every download request (to the mirrors as
+	// well), like "Authorization: Bearer ...".
+	Headers []string
+	// Source streams the image from here over SSH instead of having the
+	// rescue system download it, for machines without internet access.
+	// The image URL is not used then, neither are mirrors and the cache.
+	Source io.Reader
+	// Size of the source, if known.
+	Size int64
+	// Prefetch is the staging directory of PrefetchImage, which has been
+	// started with the same URL and options. The image is read from there
+	// as the prefetch goes on. The staging directory is removed when done.
+	Prefetch string
+}
+
+// Progress of InstallRawImage.
+type Progress struct {
+	// Downloaded bytes of the (compressed) image.
+	Downloaded int64
+	// Written bytes of the decompressed image.
+	Written int64
+	// Size of the download, 0 while unknown.
+	Size int64
+}
+
+// InstallResult tells what InstallRawImage wrote to the device.
+type InstallResult struct {
+	// Bytes is the size of the decompressed image.
+	Bytes int64
+	// SHA256 of the decompressed image, only set with InstallOptions.Verify.
+	SHA256 string
+}
+
+// InstallRawImage streams the image URL through the decompressor of its
+// format (see ImageFormat) straight onto the given device. Broken
+// downloads are resumed where they stopped.
+func InstallRawImage(m remotecommand.Machine, imageURL string, format image.Format, device string, opts *InstallOptions, cb ssh.HostKeyCallback) (*InstallResult, error) {
+	if opts == nil {
+		opts = &InstallOptions{}
+	}
+	cmd, err := installRawImageScript(imageURL, format, device, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := &installOutput{progress: opts.Progress}
+	if err := remotecommand.Run(m, cmd, opts.Source, &lineWriter{fn: out.line}, cb); err != nil {
+		return nil, fmt.Errorf("Remote command InstallImage failed: %w", err)
+	}
+	res, err := out.result()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("Remote command InstallImage failed: %w", err)
 	}
+	return res, nil
+}
+
+// parseInstallResult parses the complete stdout of the install script.
+func parseInstallResult(stdout []byte, progress func(Progress)) (*InstallResult, error) {
+	out := &installOutput{progress: progress}
+	w := &lineWriter{fn: out.line}
+	w.Write(stdout)
+	return out.result()
+}
 
-	switch ext := filepath.Ext(parsedURL.Path); ext {
-	case ".iso":
-		return installISOImage(m, imageURL, device, cb)
-	case ".xz":
-		return installRawImageXZ(m, imageURL, device, cb)
-	case ".zst":
-		return installImageZstandard(m, imageURL, device, cb)
-	default:
-		return fmt.Errorf("InstallRawImage canot handle a %s file", ext)
+// installOutput collects the lines of "key value..." the install script
+// prints to stdout.
+type installOutput struct {
+	progress func(Progress)
+	res      InstallResult
+	err      error
+}
+
+func (o *installOutput) line(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	switch fields[0] {
+	case "progress":
+		if len(fields) != 4 || o.progress == nil {
+			return
+		}
+		var p Progress
+		for i, v := range []*int64{&p.Downloaded, &p.Written, &p.Size} {
+			n, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				return
+			}
+			*v = n
+		}
+		o.progress(p)
+	case "bytes":
+		if len(fields) != 2 {
+			return
+		}
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			o.err = err
+			return
+		}
+		o.res.Bytes = n
+	case "sha256":
+		if len(fields) == 2 {
+			o.res.SHA256 = fields[1]
+		}
 	}
 }
 
-// installRawImageXZ downloads the raw.xz image URL and writes it to the given device.
-func installRawImageXZ(m remotecommand.Machine, imageURL, device string, cb ssh.HostKeyCallback) error {
-	cmd := fmt.Sprintf(`
-    wget %s -O talos-metal.raw.xz \
-    && cat talos-metal.raw.xz \
-    |  xz -d \
-    |  dd of=%s bs=4M \
-    && sync`, imageURL, device)
-	if _, err := remotecommand.Command(m, cmd, cb); err != nil {
-		return fmt.Errorf("Remote command InstallImage failed: %w", err)
+func (o *installOutput) result() (*InstallResult, error) {
+	if o.err != nil {
+		return nil, o.err
 	}
-	return nil
-}
-
-// installImageZstandard downloads the raw.zst image URL and writes it to the given device.
-func installImageZstandard(m remotecommand.Machine, imageURL, device string, cb ssh.HostKeyCallback) error {
-	cmd := fmt.Sprintf(`
-    wget %s -O talos-metal.raw.zst \
-    && cat talos-metal.raw.zst \
-    |  zstd -d \
-    |  dd of=%s bs=4M \
-    && sync`, imageURL, device)
-	if _, err := remotecommand.Command(m, cmd, cb); err != nil {
-		return fmt.Errorf("Remote command InstallImage failed: %w", err)
+	if o.res.Bytes == 0 {
+		return nil, fmt.Errorf("nothing has been written")
 	}
-	return nil
+	return &o.res, nil
 }
 
-// installISOImage downloads the ISO image URL and writes it to the given device.
-func installISOImage(m remotecommand.Machine, imageURL, device string, cb ssh.HostKeyCallback) error {
-	cmd := fmt.Sprintf(`
-    wget %s -O talos-metal.iso \
-    && dd if=talos-metal.iso of=%s bs=4M \
-    && sync`, imageURL, device)
-	if _, err := remotecommand.Command(m, cmd, cb); err != nil {
-		return fmt.Errorf("Remote command InstallImage failed: %w", err)
+// lineWriter calls fn for every complete line written to it.
+type lineWriter struct {
+	buf []byte
+	fn  func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+}
+
+func installRawImageScript(imageURL string, format image.Format, device string, opts *InstallOptions) (string, error) {
+	if opts == nil {
+		opts = &InstallOptions{}
+	}
+	decompressor, ok := Decompressors[format]
+	if !ok {
+		return "", fmt.Errorf("InstallRawImage cannot handle %s images", format)
 	}
-	return nil
+	urls := append([]string{imageURL}, opts.Mirrors...)
+	retries := opts.Retries
+	if retries == 0 {
+		retries = 5 * len(urls)
+	}
+	var cacheFile string
+	prefetch := opts.Prefetch
+	if opts.Source != nil {
+		prefetch = ""
+	}
+	if opts.CacheDir != "" && opts.Source == nil {
+		name := opts.SHA256
+		if name == "" {
+			sum := sha256.Sum256([]byte(imageURL))
+			name = hex.EncodeToString(sum[:8])
+		}
+		cacheFile = fmt.Sprintf("%s/%s.%s", strings.TrimSuffix(opts.CacheDir, "/"), name, format)
+	}
+	var b strings.Builder
+	err := installRawImageTemplate.Execute(&b, map[string]any{
+		"URLs":         urls,
+		"SHA256":       strings.ToLower(opts.SHA256),
+		"Retries":      retries,
+		"CacheDir":     opts.CacheDir,
+		"CacheFile":    cacheFile,
+		"Decompressor": decompressor,
+		"Device":       device,
+		"Verify":       opts.Verify,
+		"Headers":      opts.Headers,
+		"Stdin":        opts.Source != nil,
+		"Size":         opts.Size,
+		"Prefetch":     prefetch,
+	})
+	return b.String(), err
+}
+
+// The download is a loop of wget calls, each one resuming (range request)
+// where the previous one broke off, from the next mirror. wget skips the
+// bytes already received itself, should a server ignore the range. The
+// bytes that made it through are counted by dd. Exit codes of all
+// pipeline members are being written to files, because POSIX sh only
+// reports the last one. The download keeps its state in $tmp, which is
+// the staging directory for prefetches.
+var installRawImageTemplate = template.Must(template.New("install").Funcs(template.FuncMap{
+	"quote": shellQuote,
+}).Parse(`
+tmp=$(mktemp -d)
+trap 'kill $progress $digest $verify 2> /dev/null; rm -rf "$tmp"
+{{- with .Prefetch}}; totalos_stop_prefetch {{quote .}}{{end}}' EXIT
+{{- if .Prefetch}}
+dl={{quote .Prefetch}}
+{{- else}}
+dl="$tmp"
+{{- end}}
+{{template "fetch" .}}
+{{- if .Prefetch}}
+
+{{template "stop-prefetch"}}
+
+# streams the image the prefetch downloads, following the file as it grows
+totalos_follow() {
+  off=0
+  while :; do
+    status=$(cat "$dl/status" 2> /dev/null)
+    tail -c +$((off + 1)) "$dl/image" 2> /dev/null | dd bs=64k 2> "$tmp/follow"
+    off=$((off + $(totalos_bytes "$tmp/follow")))
+    if [ -n "$status" ]; then
+      [ "$status" = 0 ] || cat "$dl/stderr" >&2
+      return "$status"
+    fi
+    sleep 1
+  done
+}
+{{- end}}
+
+totalos_download() {
+{{- if .Prefetch}}
+  totalos_follow
+{{- else}}
+  totalos_fetch{{range .URLs}} {{quote .}}{{end}}
+{{- end}}
+}
+
+totalos_source() {
+{{- if .Stdin}}
+  echo {{.Size}} > "$tmp/size"
+  dd bs=64k status=progress 2> "$tmp/count"
+{{- else if .CacheFile}}
+  if [ ! -f {{quote .CacheFile}} ]; then
+    mkdir -p {{quote .CacheDir}} \
+    && totalos_download > {{quote (print .CacheFile ".part")}} \
+    && mv {{quote (print .CacheFile ".part")}} {{quote .CacheFile}} \
+    || { rm -f {{quote (print .CacheFile ".part")}}; return 1; }
+  fi
+  cat {{quote .CacheFile}}
+{{- else}}
+  totalos_download
+{{- end}}
+}
+
+# progress <downloaded> <written> <size>, once a second
+totalos_progress() {
+  while sleep 1; do
+    size=$(cat "$dl/size" 2> /dev/null \
+      || awk 'tolower($1) == "content-length:" {n = $2} END {print n + 0}' "$dl/headers" 2> /dev/null \
+      | tr -d '\r')
+    echo "progress $(($(cat "$dl/offset" 2> /dev/null || echo 0) + $(totalos_bytes "$dl/count"))) $(totalos_bytes "$tmp/write") ${size:-0}"
+  done
+}
+totalos_progress &
+progress=$!
+
+{{- if .SHA256}}
+
+mkfifo "$tmp/digest"
+sha256sum < "$tmp/digest" > "$tmp/digest.sha256" &
+digest=$!
+{{- end}}
+
+{{- if .Verify}}
+
+mkfifo "$tmp/verify"
+sha256sum < "$tmp/verify" > "$tmp/sha256" &
+verify=$!
+{{- end}}
+
+{ totalos_source; echo $? > "$tmp/source"; } \
+{{- if .SHA256}}
+| tee "$tmp/digest" \
+{{- end}}
+| { {{.Decompressor}}; echo $? > "$tmp/decompress"; } \
+{{- if .Verify}}
+| tee "$tmp/verify" \
+{{- end}}
+| dd of={{quote .Device}} bs=4M conv=fsync status=progress 2> "$tmp/write" \
+|| { cat "$tmp/write" >&2; exit 1; }
+[ "$(cat "$tmp/source")" = 0 ] || { echo "download failed" >&2; exit 1; }
+{{- if .SHA256}}
+wait "$digest"
+if [ "$(cut -d ' ' -f 1 "$tmp/digest.sha256")" != {{quote .SHA256}} ]; then
+{{- if .CacheFile}}
+  rm -f {{quote .CacheFile}}
+{{- end}}
+  echo "sha256 of the image is $(cut -d ' ' -f 1 "$tmp/digest.sha256"), want {{.SHA256}}" >&2
+  exit 1
+fi
+{{- end}}
+[ "$(cat "$tmp/decompress")" = 0 ] || { echo "decompression failed" >&2; exit 1; }
+sync
+kill "$progress"
+echo "bytes $(totalos_bytes "$tmp/write")"
+{{- if .Verify}}
+wait "$verify"
+echo "sha256 $(cut -d ' ' -f 1 "$tmp/sha256")"
+{{- end}}
+{{- define "fetch"}}
+# prints the bytes of the last status line of a dd log
+totalos_bytes() {
+  tr '\r' '\n' < "$1" 2> /dev/null | awk '/bytes/ {n = $1} END {print n + 0}'
+}
+
+# prints the nth (1-based) of the following arguments
+totalos_nth() {
+  shift "$1"
+  echo "$1"
+}
+
+# downloads the first of the URLs to stdout, failing over to the others
+totalos_fetch() {
+  off=0
+  attempt=0
+  size=
+  while :; do
+    url=$(totalos_nth $((attempt % $# + 1)) "$@")
+    echo "$off" > "$tmp/offset"
+    {
+      wget -q -S -t 1 -T 30{{range .Headers}} --header {{quote .}}{{end}} --start-pos="$off" -O - "$url"
+      echo $? > "$tmp/wget"
+    } 2> "$tmp/headers" | dd bs=64k status=progress 2> "$tmp/count"
+    if [ -z "$size" ]; then
+      # the total of a partial response, the length of a complete one
+      size=$(awk '
+        tolower($1) == "content-range:" {split($3, r, "/"); total = r[2]}
+        tolower($1) == "content-length:" {n = $2}
+        END {print (total != "" ? total : n)}
+      ' "$tmp/headers" | tr -d '\r')
+      [ -n "$size" ] && echo "$size" > "$tmp/size"
+    fi
+    off=$((off + $(totalos_bytes "$tmp/count")))
+    if [ "$(cat "$tmp/wget")" = 0 ] && { [ -z "$size" ] || [ "$off" -eq "$size" ]; }; then
+      echo "$off" > "$tmp/offset"
+      rm -f "$tmp/count"
+      return 0
+    fi
+    attempt=$((attempt + 1))
+    if [ "$attempt" -gt {{.Retries}} ]; then
+      echo "download failed after $off bytes" >&2
+      return 1
+    fi
+    echo "download from $url broke off, resuming at $off of ${size:-unknown} bytes" >&2
+    sleep 1
+  done
+}
+{{- end}}
+{{- define "stop-prefetch"}}
+# stops the prefetch of the staging directory and removes it
+totalos_stop_prefetch() {
+  [ -f "$1/pid" ] && kill -- -"$(cat "$1/pid")" 2> /dev/null
+  rm -rf "$1"
 }
+{{- end}}
+`))
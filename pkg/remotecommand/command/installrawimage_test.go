@@ -0,0 +1,139 @@
+package command
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+// TestInstallRawImageScript runs the remote script locally against
+// servers breaking off downloads halfway.
+func TestInstallRawImageScript(t *testing.T) {
+	for _, bin := range []string{"sh", "wget", "gzip", "dd", "sha256sum"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is not available", bin)
+		}
+	}
+	raw := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(raw)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(raw)
+	zw.Close()
+	rawSum := sha256.Sum256(raw)
+	compressedSum := sha256.Sum256(compressed.Bytes())
+
+	breakOff := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Length", strconv.Itoa(compressed.Len()))
+		w.Write(compressed.Bytes()[:compressed.Len()/2])
+		panic(http.ErrAbortHandler)
+	}
+	var requests atomic.Int32
+	flakyHandler := func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			breakOff(w)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(compressed.Bytes()))
+	}
+	flaky := httptest.NewServer(http.HandlerFunc(flakyHandler))
+	defer flaky.Close()
+	authorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		flakyHandler(w, r)
+	}))
+	defer authorized.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		breakOff(w)
+	}))
+	defer broken.Close()
+
+	for _, tc := range []struct {
+		name    string
+		url     string
+		opts    *InstallOptions
+		wantErr string
+	}{
+		{"resume", flaky.URL + "/image", &InstallOptions{Verify: true}, ""},
+		{"resume into cache", flaky.URL + "/image", &InstallOptions{Verify: true, CacheDir: t.TempDir()}, ""},
+		{"fail over to mirror", broken.URL + "/image", &InstallOptions{Mirrors: []string{flaky.URL + "/image"}, SHA256: hex.EncodeToString(compressedSum[:])}, ""},
+		{"headers", authorized.URL + "/image", &InstallOptions{Headers: []string{"Authorization: Bearer t0k"}}, ""},
+		{"stdin", "", &InstallOptions{Source: bytes.NewReader(compressed.Bytes()), SHA256: hex.EncodeToString(compressedSum[:]), Verify: true}, ""},
+		{"digest mismatch", flaky.URL + "/image", &InstallOptions{SHA256: hex.EncodeToString(rawSum[:])}, "sha256 of the image is " + hex.EncodeToString(compressedSum[:])},
+	} {
+		requests.Store(0)
+		device := filepath.Join(t.TempDir(), "disk")
+		script, err := installRawImageScript(tc.url, image.FormatGzip, device, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", script)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tc.opts.Source, &stdout, &stderr
+		err = cmd.Run()
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(stderr.String(), tc.wantErr) {
+				t.Errorf("%s: got error %v (%s), want %q", tc.name, err, stderr.String(), tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: script failed: %v\n%s", tc.name, err, stderr.String())
+		}
+		if want := fmt.Sprintf("resuming at %d of %d bytes", compressed.Len()/2, compressed.Len()); tc.opts.Source == nil && !strings.Contains(stderr.String(), want) {
+			t.Errorf("%s: stderr %q does not contain %q", tc.name, stderr.String(), want)
+		}
+		res, err := parseInstallResult(stdout.Bytes(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := InstallResult{Bytes: int64(len(raw))}
+		if tc.opts.Verify {
+			want.SHA256 = hex.EncodeToString(rawSum[:])
+		}
+		if *res != want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *res, want)
+		}
+		written, err := os.ReadFile(device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(written, raw) {
+			t.Errorf("%s: device content differs from image (%d of %d bytes)", tc.name, len(written), len(raw))
+		}
+	}
+}
+
+func TestParseInstallResult(t *testing.T) {
+	stdout := []byte("progress 100 0 1000\nprogress 1000 4096 1000\nbytes 4096\nsha256 abc\n")
+	var got []Progress
+	res, err := parseInstallResult(stdout, func(p Progress) { got = append(got, p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Progress{{100, 0, 1000}, {1000, 4096, 1000}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got progress %+v, want %+v", got, want)
+	}
+	if *res != (InstallResult{Bytes: 4096, SHA256: "abc"}) {
+		t.Errorf("got %+v", *res)
+	}
+}
@@ -9,12 +9,15 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// IPv4 address of ethernet device
+// IPv4 address of the interface of the default route (like an ethernet
+// device, bond or VLAN), or nil if it has none
 func IPv4(m remotecommand.Machine, cb ssh.HostKeyCallback) (net.IP, error) {
-	cmd := `
+	cmd := fmt.Sprintf(`
+    %s
     ip -4 -j a show \
-    | jq -r '.[] | select(.ifname | startswith("en") or startswith("eth")) | .addr_info[].local'
-  `
+    | jq -r --arg dev "$dev" '.[] | %s | .addr_info[].local' \
+    | head -n 1
+  `, uplinkDevice("-4"), uplinkSelect)
 	stdout, err := remotecommand.Command(m, cmd, cb)
 	if err != nil {
 		return nil, fmt.Errorf("Remote command IPv4 failed: %w", err)
@@ -9,11 +9,11 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// IPv4Gateway returns the default gateway IPv4 of ethernet device
+// IPv4Gateway returns the default gateway IPv4
 func IPv4Gateway(m remotecommand.Machine, cb ssh.HostKeyCallback) (net.IP, error) {
 	cmd := `
-    ip -j -4 route show \
-    | jq -r '.[] | select(.dev | startswith("en") or startswith("eth")) | select(.dst == "default") | .gateway'
+    ip -j -4 route show default \
+    | jq -r '.[0].gateway // empty'
   `
 	stdout, err := remotecommand.Command(m, cmd, cb)
 	if err != nil {
@@ -10,16 +10,22 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// IPv4Netmask returns the IPv4 netmask of ethernet device
+// IPv4Netmask returns the IPv4 netmask of the interface of the default
+// route, or nil if it has no IPv4 address (like on IPv6-only sites)
 func IPv4Netmask(m remotecommand.Machine, cb ssh.HostKeyCallback) (net.IP, error) {
-	cmd := `
+	cmd := fmt.Sprintf(`
+    %s
     ip -4 -j a show \
-    | jq -r '.[] | select(.ifname | startswith("en") or startswith("eth")) | .addr_info[].prefixlen'
-  `
+    | jq -r --arg dev "$dev" '.[] | %s | .addr_info[].prefixlen' \
+    | head -n 1
+  `, uplinkDevice("-4"), uplinkSelect)
 	stdout, err := remotecommand.Command(m, cmd, cb)
 	if err != nil {
 		return nil, fmt.Errorf("Remote command IPv4Netmask failed: %w", err)
 	}
+	if strings.TrimSpace(string(stdout)) == "" {
+		return nil, nil
+	}
 	prefixlen, err := strconv.ParseInt(strings.TrimSpace(string(stdout)), 10, 32)
 	if err != nil {
 		return nil, fmt.Errorf("Remote command IPv4Netmask failed: %w", err)
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// IPv6 returns the global IPv6 address of the interface of the default
+// route with its prefix, or nil if there is none (like on IPv4-only
+// sites).
+func IPv6(m remotecommand.Machine, cb ssh.HostKeyCallback) (*net.IPNet, error) {
+	cmd := fmt.Sprintf(`
+    %s
+    ip -6 -j a show \
+    | jq -r --arg dev "$dev" '.[] | %s | .addr_info[] | select(.scope == "global" and (.temporary | not)) | "\(.local)/\(.prefixlen)"'
+  `, uplinkDevice("-6"), uplinkSelect)
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command IPv6 failed: %w", err)
+	}
+	ipNet, err := parseIPv6(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command IPv6 failed: %w", err)
+	}
+	return ipNet, nil
+}
+
+// parseIPv6 takes the first address/prefixlen line.
+func parseIPv6(stdout []byte) (*net.IPNet, error) {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(stdout)), "\n")
+	if line == "" {
+		return nil, nil
+	}
+	ip, network, err := net.ParseCIDR(strings.TrimSpace(line))
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() != nil {
+		return nil, fmt.Errorf("%s is no IPv6 address", ip)
+	}
+	return &net.IPNet{IP: ip, Mask: network.Mask}, nil
+}
@@ -0,0 +1,19 @@
+package command
+
+import "testing"
+
+func TestParseIPv6(t *testing.T) {
+	ipNet, err := parseIPv6([]byte("2a01:4f8:10a:1f2::2/64\n2a01:4f8:10a:1f2::3/64\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ipNet.String(); got != "2a01:4f8:10a:1f2::2/64" {
+		t.Errorf("got %s", got)
+	}
+	if ipNet, err := parseIPv6([]byte("\n")); ipNet != nil || err != nil {
+		t.Errorf("got %v, %v without address", ipNet, err)
+	}
+	if _, err := parseIPv6([]byte("192.168.0.42/24\n")); err == nil {
+		t.Error("got no error for an IPv4 address")
+	}
+}
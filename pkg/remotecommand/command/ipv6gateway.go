@@ -0,0 +1,24 @@
+package command
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// IPv6Gateway returns the default gateway IPv6, often link-local (like
+// fe80::1), or nil if there is none.
+func IPv6Gateway(m remotecommand.Machine, cb ssh.HostKeyCallback) (net.IP, error) {
+	cmd := `
+    ip -j -6 route show default \
+    | jq -r '.[0].gateway // empty'
+  `
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command IPv6Gateway failed: %w", err)
+	}
+	return net.ParseIP(strings.TrimSpace(string(stdout))), nil
+}
@@ -0,0 +1,123 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// Partitions of a Talos system disk, the device paths of the partitions
+// found by label. Absent partitions are empty.
+type Partitions struct {
+	Device string
+	EFI    string
+	BIOS   string
+	Boot   string
+	Meta   string
+	// Layout lists all partitions with their labels, for error messages.
+	Layout []string
+}
+
+// RequireBoot returns the BOOT partition, or an error telling the layout
+// found instead.
+func (p *Partitions) RequireBoot() (string, error) {
+	if p.Boot == "" {
+		return "", p.missing("BOOT")
+	}
+	return p.Boot, nil
+}
+
+func (p *Partitions) missing(label string) error {
+	if len(p.Layout) == 0 {
+		return fmt.Errorf("%s has no partitions, the image does not look like a Talos disk image", p.Device)
+	}
+	return fmt.Errorf("%s has no %s partition, found %s", p.Device, label, strings.Join(p.Layout, ", "))
+}
+
+// SystemPartitions reads the partition table of the device and finds
+// the Talos partitions by GPT partition label (EFI, BIOS, BOOT, META), or
+// else by file system label. Unlike guessing them by index, this works
+// for any device naming (sda, nvme0n1, mmcblk0, loop0, md, dm) and
+// partition order.
+func SystemPartitions(m remotecommand.Machine, device string, cb ssh.HostKeyCallback) (*Partitions, error) {
+	cmd := fmt.Sprintf(`
+    udevadm settle 2> /dev/null
+    lsblk -J -o NAME,KNAME,TYPE,PARTLABEL,LABEL %s
+  `, shellQuote(device))
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command SystemPartitions failed: %w", err)
+	}
+	p, err := parsePartitions(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command SystemPartitions failed: %w", err)
+	}
+	p.Device = device
+	return p, nil
+}
+
+type lsblkDevice struct {
+	Name      string        `json:"name"`
+	KName     string        `json:"kname"`
+	Type      string        `json:"type"`
+	PartLabel string        `json:"partlabel"`
+	Label     string        `json:"label"`
+	Children  []lsblkDevice `json:"children"`
+}
+
+func parsePartitions(stdout []byte) (*Partitions, error) {
+	var out struct {
+		BlockDevices []lsblkDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(stdout, &out); err != nil {
+		return nil, err
+	}
+	p := &Partitions{}
+	var parts []lsblkDevice
+	for _, d := range out.BlockDevices {
+		for _, c := range d.Children {
+			if c.Type == "part" {
+				parts = append(parts, c)
+			}
+		}
+	}
+	// GPT partition labels win over file system labels
+	for _, byPartLabel := range []bool{true, false} {
+		for _, c := range parts {
+			label := c.Label
+			if byPartLabel {
+				label = c.PartLabel
+			}
+			var target *string
+			switch strings.ToUpper(label) {
+			case "EFI":
+				target = &p.EFI
+			case "BIOS":
+				target = &p.BIOS
+			case "BOOT":
+				target = &p.Boot
+			case "META":
+				target = &p.Meta
+			default:
+				continue
+			}
+			if *target == "" {
+				*target = "/dev/" + c.KName
+			}
+		}
+	}
+	for _, c := range parts {
+		label := c.PartLabel
+		if label == "" {
+			label = c.Label
+		}
+		if label == "" {
+			label = "no label"
+		}
+		p.Layout = append(p.Layout, fmt.Sprintf("%s (%s)", c.Name, label))
+	}
+	return p, nil
+}
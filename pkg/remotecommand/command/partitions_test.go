@@ -0,0 +1,64 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePartitions(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		stdout  string
+		want    Partitions
+		wantErr string
+	}{
+		{
+			"talos grub image on mmc",
+			`{"blockdevices": [{"name": "mmcblk0", "kname": "mmcblk0", "type": "disk", "partlabel": null, "label": null, "children": [
+			  {"name": "mmcblk0p1", "kname": "mmcblk0p1", "type": "part", "partlabel": "EFI", "label": "EFI"},
+			  {"name": "mmcblk0p2", "kname": "mmcblk0p2", "type": "part", "partlabel": "BIOS", "label": null},
+			  {"name": "mmcblk0p3", "kname": "mmcblk0p3", "type": "part", "partlabel": "BOOT", "label": "BOOT"},
+			  {"name": "mmcblk0p4", "kname": "mmcblk0p4", "type": "part", "partlabel": "META", "label": null}
+			]}]}`,
+			Partitions{EFI: "/dev/mmcblk0p1", BIOS: "/dev/mmcblk0p2", Boot: "/dev/mmcblk0p3", Meta: "/dev/mmcblk0p4"},
+			"",
+		},
+		{
+			"file system labels on device mapper",
+			`{"blockdevices": [{"name": "vg-talos", "kname": "dm-0", "type": "lvm", "children": [
+			  {"name": "vg-talos1", "kname": "dm-1", "type": "part", "label": "EFI"},
+			  {"name": "vg-talos3", "kname": "dm-3", "type": "part", "label": "BOOT"}
+			]}]}`,
+			Partitions{EFI: "/dev/dm-1", Boot: "/dev/dm-3"},
+			"",
+		},
+		{
+			"systemd-boot image without boot partition",
+			`{"blockdevices": [{"name": "sda", "kname": "sda", "type": "disk", "children": [
+			  {"name": "sda1", "kname": "sda1", "type": "part", "partlabel": "EFI", "label": "EFI"},
+			  {"name": "sda2", "kname": "sda2", "type": "part", "partlabel": "META"}
+			]}]}`,
+			Partitions{EFI: "/dev/sda1", Meta: "/dev/sda2"},
+			"/dev/sda has no BOOT partition, found sda1 (EFI), sda2 (META)",
+		},
+		{
+			"wiped disk",
+			`{"blockdevices": [{"name": "sda", "kname": "sda", "type": "disk"}]}`,
+			Partitions{},
+			"/dev/sda has no partitions",
+		},
+	} {
+		got, err := parsePartitions([]byte(tc.stdout))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got.Device = "/dev/sda"
+		if got.EFI != tc.want.EFI || got.BIOS != tc.want.BIOS || got.Boot != tc.want.Boot || got.Meta != tc.want.Meta {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+		_, err = got.RequireBoot()
+		if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"github.com/fabiant7t/totalos/pkg/server"
+	"golang.org/x/crypto/ssh"
+)
+
+// pciClasses are the class prefixes PCIDevices reports: mass storage,
+// network, display, fibre channel and processing accelerators.
+var pciClasses = []string{"01", "02", "03", "0c04", "12"}
+
+// PCIDevices returns the network, storage and display controllers and
+// accelerators on the PCI bus.
+func PCIDevices(m remotecommand.Machine, cb ssh.HostKeyCallback) ([]server.PCIDevice, error) {
+	cmd := `
+    for d in /sys/bus/pci/devices/*; do
+      [ -r "$d/vendor" ] || continue
+      driver=-
+      [ -e "$d/driver" ] && driver=$(basename "$(readlink "$d/driver")")
+      echo "$(basename "$d") $(cat "$d/vendor") $(cat "$d/device") $(cat "$d/class") $driver"
+    done
+  `
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command PCIDevices failed: %w", err)
+	}
+	return parsePCIDevices(stdout), nil
+}
+
+func parsePCIDevices(stdout []byte) []server.PCIDevice {
+	devices := []server.PCIDevice{}
+	for _, line := range strings.Split(string(stdout), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			continue
+		}
+		d := server.PCIDevice{
+			Slot:   fields[0],
+			Vendor: strings.TrimPrefix(fields[1], "0x"),
+			Device: strings.TrimPrefix(fields[2], "0x"),
+			Class:  strings.TrimPrefix(fields[3], "0x"),
+		}
+		if fields[4] != "-" {
+			d.Driver = fields[4]
+		}
+		for _, class := range pciClasses {
+			if strings.HasPrefix(d.Class, class) {
+				devices = append(devices, d)
+				break
+			}
+		}
+	}
+	return devices
+}
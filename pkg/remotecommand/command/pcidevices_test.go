@@ -0,0 +1,26 @@
+package command
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/server"
+)
+
+func TestParsePCIDevices(t *testing.T) {
+	stdout := []byte(`0000:00:00.0 0x8086 0x3e0f 0x060000 -
+0000:00:02.0 0x8086 0x3e92 0x030000 i915
+0000:01:00.0 0x14e4 0x164f 0x020000 bnx2x
+0000:02:00.0 0x1000 0x0097 0x010700 mpt3sas
+0000:03:00.0 0x1077 0x2261 0x0c0400 -
+`)
+	want := []server.PCIDevice{
+		{Slot: "0000:00:02.0", Vendor: "8086", Device: "3e92", Class: "030000", Driver: "i915"},
+		{Slot: "0000:01:00.0", Vendor: "14e4", Device: "164f", Class: "020000", Driver: "bnx2x"},
+		{Slot: "0000:02:00.0", Vendor: "1000", Device: "0097", Class: "010700", Driver: "mpt3sas"},
+		{Slot: "0000:03:00.0", Vendor: "1077", Device: "2261", Class: "0c0400"},
+	}
+	if got := parsePCIDevices(stdout); !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// PrefetchDir is the staging directory of PrefetchImage on the rescue
+// system.
+const PrefetchDir = "/tmp/totalos-prefetch"
+
+// PrefetchHeadroom is the room left on the file system of the staging
+// directory next to the image, which is usually RAM backed.
+const PrefetchHeadroom = 256 << 20
+
+// ErrPrefetchSkipped is returned by PrefetchImage when the image does not
+// fit into the staging directory, or its size is unknown. The image is to
+// be streamed while writing then.
+var ErrPrefetchSkipped = errors.New("prefetch skipped")
+
+// PrefetchImage starts downloading the image into PrefetchDir on the
+// rescue system and returns right away, while the download goes on in
+// the background. Of the options, Mirrors, Retries, Headers and Size are
+// taken into account. The size defaults to the Content-Length of the
+// image URL, the image has to fit into the free space of the staging
+// directory with PrefetchHeadroom to spare, or ErrPrefetchSkipped is
+// returned. Pass the returned staging directory to InstallRawImage
+// as InstallOptions.Prefetch, or stop the prefetch with StopPrefetch.
+// A prefetch of an earlier run is being stopped.
+func PrefetchImage(m remotecommand.Machine, imageURL string, opts *InstallOptions, cb ssh.HostKeyCallback) (string, error) {
+	if opts == nil {
+		opts = &InstallOptions{}
+	}
+	cmd, err := prefetchImageScript(imageURL, PrefetchDir, opts)
+	if err != nil {
+		return "", err
+	}
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return "", fmt.Errorf("Remote command PrefetchImage failed: %w", err)
+	}
+	if reason, ok := strings.CutPrefix(strings.TrimSpace(string(stdout)), "skip "); ok {
+		return "", fmt.Errorf("%w: %s", ErrPrefetchSkipped, reason)
+	}
+	return PrefetchDir, nil
+}
+
+// StopPrefetch stops the prefetch of the staging directory, like when
+// the image turns out to be installed already, and removes its data.
+func StopPrefetch(m remotecommand.Machine, stage string, cb ssh.HostKeyCallback) error {
+	var b strings.Builder
+	if err := prefetchImageTemplate.ExecuteTemplate(&b, "stop-prefetch", nil); err != nil {
+		return err
+	}
+	fmt.Fprintf(&b, "\ntotalos_stop_prefetch %s\n", shellQuote(stage))
+	if _, err := remotecommand.Command(m, b.String(), cb); err != nil {
+		return fmt.Errorf("Remote command StopPrefetch failed: %w", err)
+	}
+	return nil
+}
+
+func prefetchImageScript(imageURL, stage string, opts *InstallOptions) (string, error) {
+	urls := append([]string{imageURL}, opts.Mirrors...)
+	retries := opts.Retries
+	if retries == 0 {
+		retries = 5 * len(urls)
+	}
+	var b strings.Builder
+	err := prefetchImageTemplate.Execute(&b, map[string]any{
+		"Stage":   stage,
+		"URLs":    urls,
+		"Retries": retries,
+		"Headers": opts.Headers,
+		"Size":    opts.Size,
+		"Room":    PrefetchHeadroom >> 10,
+	})
+	return b.String(), err
+}
+
+// The free space (in KiB) is taken from the parent of the staging
+// directory, which exists before the staging directory is being created.
+// The background script runs in its own session, so that it outlives the
+// SSH session and can be stopped together with its wget. Being started
+// by a shell without job control, setsid does not fork and $! is the
+// session (and process group) ID. It downloads to
+// the image file of the staging directory and writes the exit code of the
+// download to the status file when done. The download state (offset,
+// count, size) is where the progress of InstallRawImage looks for it.
+var prefetchImageTemplate = template.Must(template.Must(installRawImageTemplate.Clone()).New("prefetch").Parse(`
+{{template "stop-prefetch"}}
+totalos_stop_prefetch {{quote .Stage}}
+size={{.Size}}
+if [ "$size" -eq 0 ]; then
+  size=$(wget -q -S --spider -t 1 -T 30{{range .Headers}} --header {{quote .}}{{end}} {{quote (index .URLs 0)}} 2>&1 \
+    | awk 'tolower($1) == "content-length:" {n = $2} END {print n + 0}' | tr -d '\r')
+fi
+free=$(df -Pk "$(dirname {{quote .Stage}})" | awk 'NR == 2 {print $4}')
+if [ "${size:-0}" -eq 0 ]; then
+  echo "skip size of the image unknown"
+  exit 0
+fi
+if [ "${free:-0}" -lt $((size / 1024 + {{.Room}})) ]; then
+  echo "skip $size bytes do not fit into $((free * 1024)) bytes free of $(dirname {{quote .Stage}})"
+  exit 0
+fi
+mkdir -p {{quote .Stage}} || exit 1
+cat > {{quote .Stage}}/prefetch.sh << 'TOTALOS_PREFETCH'
+tmp={{quote .Stage}}
+{{template "fetch" .}}
+totalos_fetch{{range .URLs}} {{quote .}}{{end}} > "$tmp/image"
+echo $? > "$tmp/status"
+TOTALOS_PREFETCH
+setsid sh {{quote .Stage}}/prefetch.sh < /dev/null > /dev/null 2> {{quote .Stage}}/stderr &
+echo $! > {{quote .Stage}}/pid
+`))
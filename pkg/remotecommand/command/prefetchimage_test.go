@@ -0,0 +1,130 @@
+package command
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/totalos/pkg/image"
+)
+
+// TestPrefetchImageScript runs the prefetch and the install script
+// locally, the install following a download that is still going on.
+func TestPrefetchImageScript(t *testing.T) {
+	for _, bin := range []string{"sh", "wget", "gzip", "dd", "sha256sum", "setsid", "tail"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is not available", bin)
+		}
+	}
+	raw := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(raw)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(raw)
+	zw.Close()
+	compressedSum := sha256.Sum256(compressed.Bytes())
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		half := compressed.Len() / 2
+		w.Header().Set("Content-Length", strconv.Itoa(compressed.Len()))
+		w.Write(compressed.Bytes()[:half])
+		w.(http.Flusher).Flush()
+		time.Sleep(1500 * time.Millisecond)
+		w.Write(compressed.Bytes()[half:])
+	}))
+	defer slow.Close()
+
+	stage := filepath.Join(t.TempDir(), "prefetch")
+	opts := &InstallOptions{Headers: []string{"Authorization: Bearer t0k"}, SHA256: hex.EncodeToString(compressedSum[:])}
+	script, err := prefetchImageScript(slow.URL+"/image", stage, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("sh", "-c", script).CombinedOutput(); err != nil || bytes.Contains(out, []byte("skip")) {
+		t.Fatalf("prefetch script failed: %v\n%s", err, out)
+	}
+
+	device := filepath.Join(t.TempDir(), "disk")
+	opts.Prefetch = stage
+	script, err = installRawImageScript(slow.URL+"/image", image.FormatGzip, device, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("install script failed: %v\n%s", err, stderr.String())
+	}
+	res, err := parseInstallResult(stdout.Bytes(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Bytes != int64(len(raw)) {
+		t.Errorf("got %d bytes, want %d", res.Bytes, len(raw))
+	}
+	written, err := os.ReadFile(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, raw) {
+		t.Errorf("device content differs from image (%d of %d bytes)", len(written), len(raw))
+	}
+	if _, err := os.Stat(stage); !os.IsNotExist(err) {
+		t.Errorf("staging directory has not been removed: %v", err)
+	}
+}
+
+// TestPrefetchImageScriptSkips wants images too large for the staging
+// directory, and those of unknown size, to be left to streaming.
+func TestPrefetchImageScriptSkips(t *testing.T) {
+	for _, bin := range []string{"sh", "wget", "df", "awk"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is not available", bin)
+		}
+	}
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush() // no Content-Length
+		w.Write([]byte("image"))
+	}))
+	defer chunked.Close()
+
+	for _, tc := range []struct {
+		name string
+		size int64
+		want string
+	}{
+		{"too large", 1 << 50, "do not fit"},
+		{"unknown size", 0, "size of the image unknown"},
+	} {
+		stage := filepath.Join(t.TempDir(), "prefetch")
+		script, err := prefetchImageScript(chunked.URL+"/image", stage, &InstallOptions{Size: tc.size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command("sh", "-c", script).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: prefetch script failed: %v\n%s", tc.name, err, out)
+		}
+		if !bytes.HasPrefix(out, []byte("skip ")) || !bytes.Contains(out, []byte(tc.want)) {
+			t.Errorf("%s: got %q, want skip with %q", tc.name, out, tc.want)
+		}
+		if _, err := os.Stat(stage); !os.IsNotExist(err) {
+			t.Errorf("%s: staging directory has been created: %v", tc.name, err)
+		}
+	}
+}
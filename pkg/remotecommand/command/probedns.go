@@ -0,0 +1,89 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// dnsQuery asks for the name servers of the root zone (ID 0x7a71,
+// recursion desired), which every recursive resolver answers.
+var dnsQuery = []byte{0x7a, 0x71, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 1}
+
+var dnsRcodes = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED"}
+
+// ProbeDNS sends a query to each of the name servers over UDP from the
+// rescue system. The result maps every server to nil if it answered, or to
+// the reason it did not.
+func ProbeDNS(m remotecommand.Machine, servers []string, cb ssh.HostKeyCallback) (map[string]error, error) {
+	if len(servers) == 0 {
+		return map[string]error{}, nil
+	}
+	stdout, err := remotecommand.Command(m, udpExchange(servers, 53, dnsQuery), cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command ProbeDNS failed: %w", err)
+	}
+	return parseUDPExchange(stdout, servers, checkDNSAnswer), nil
+}
+
+func checkDNSAnswer(answer []byte) error {
+	if len(answer) < 12 || !bytes.Equal(answer[:2], dnsQuery[:2]) || answer[2]&0x80 == 0 {
+		return errors.New("no DNS answer")
+	}
+	if rcode := int(answer[3] & 0x0f); rcode != 0 {
+		name := fmt.Sprintf("RCODE %d", rcode)
+		if rcode < len(dnsRcodes) {
+			name = dnsRcodes[rcode]
+		}
+		return fmt.Errorf("answered %s", name)
+	}
+	return nil
+}
+
+// udpExchange returns a script sending the request to the port of every
+// server and printing the server and the hex of the first datagram
+// answering within 3 seconds, nothing if none did.
+func udpExchange(servers []string, port int, request []byte) string {
+	var format strings.Builder
+	for _, b := range request {
+		fmt.Fprintf(&format, `\x%02x`, b)
+	}
+	quoted := make([]string, len(servers))
+	for i, s := range servers {
+		quoted[i] = shellQuote(s)
+	}
+	return fmt.Sprintf(`
+    for server in %s; do
+      answer=$(timeout 3 bash -c 'exec 3<>"/dev/udp/$0/$1" && printf "$2" >&3 && dd bs=4096 count=1 <&3' "$server" %d %s 2> /dev/null | od -An -v -tx1 | tr -d ' \n')
+      echo "$server $answer"
+    done
+  `, strings.Join(quoted, " "), port, shellQuote(format.String()))
+}
+
+// parseUDPExchange checks the answers of the servers, those missing did
+// not answer.
+func parseUDPExchange(stdout []byte, servers []string, check func([]byte) error) map[string]error {
+	answers := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(stdout))
+	for s.Scan() {
+		server, answer, _ := strings.Cut(strings.TrimSpace(s.Text()), " ")
+		answers[server] = answer
+	}
+	results := make(map[string]error, len(servers))
+	for _, server := range servers {
+		answer, err := hex.DecodeString(answers[server])
+		switch {
+		case err != nil || len(answer) == 0:
+			results[server] = errors.New("no answer within 3 seconds")
+		default:
+			results[server] = check(answer)
+		}
+	}
+	return results
+}
@@ -0,0 +1,41 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseUDPExchangeDNS(t *testing.T) {
+	servers := []string{"185.12.64.1", "2a01:4ff:ff00::add:1", "10.0.0.53", "192.0.2.53", "198.51.100.53"}
+	stdout := []byte("185.12.64.1 7a71818000010000000000000000020001\n" +
+		"2a01:4ff:ff00::add:1 7a71818000010000000000000000020001\n" +
+		"10.0.0.53 7a71818500010000000000000000020001\n" +
+		"192.0.2.53 \n" +
+		"198.51.100.53 1234818000010000000000000000020001\n")
+	got := parseUDPExchange(stdout, servers, checkDNSAnswer)
+	for server, want := range map[string]string{
+		"185.12.64.1":          "",
+		"2a01:4ff:ff00::add:1": "",
+		"10.0.0.53":            "answered REFUSED",
+		"192.0.2.53":           "no answer",
+		"198.51.100.53":        "no DNS answer",
+	} {
+		err := got[server]
+		if want == "" && err != nil {
+			t.Errorf("%s: got %v", server, err)
+		}
+		if want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("%s: got %v, want %s", server, err, want)
+		}
+	}
+}
+
+func TestUDPExchangeQuotes(t *testing.T) {
+	script := udpExchange([]string{"time.example.com", "2606:4700:f1::1"}, 123, ntpRequest[:2])
+	if !strings.Contains(script, `for server in 'time.example.com' '2606:4700:f1::1'; do`) {
+		t.Errorf("servers not quoted in %s", script)
+	}
+	if !strings.Contains(script, `"$server" 123 '\x23\x00'`) {
+		t.Errorf("request not passed in %s", script)
+	}
+}
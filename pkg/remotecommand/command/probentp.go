@@ -0,0 +1,38 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// ntpRequest is an SNTP client request (version 4, mode 3).
+var ntpRequest = append([]byte{0x23}, make([]byte, 47)...)
+
+// ProbeNTP sends an SNTP request to each of the time servers over UDP from
+// the rescue system. The result maps every server to nil if it answered
+// synchronized, or to the reason it did not.
+func ProbeNTP(m remotecommand.Machine, servers []string, cb ssh.HostKeyCallback) (map[string]error, error) {
+	if len(servers) == 0 {
+		return map[string]error{}, nil
+	}
+	stdout, err := remotecommand.Command(m, udpExchange(servers, 123, ntpRequest), cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command ProbeNTP failed: %w", err)
+	}
+	return parseUDPExchange(stdout, servers, checkNTPAnswer), nil
+}
+
+// checkNTPAnswer wants a server answer (mode 4) of stratum 1 to 15, 0 is a
+// kiss-o'-death and 16 unsynchronized.
+func checkNTPAnswer(answer []byte) error {
+	if len(answer) < 48 || answer[0]&0x07 != 4 {
+		return errors.New("no NTP answer")
+	}
+	if stratum := answer[1]; stratum == 0 || stratum > 15 {
+		return fmt.Errorf("answered unsynchronized (stratum %d)", stratum)
+	}
+	return nil
+}
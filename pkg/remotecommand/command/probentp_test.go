@@ -0,0 +1,30 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckNTPAnswer(t *testing.T) {
+	answer := func(mode, stratum byte) []byte {
+		b := make([]byte, 48)
+		b[0], b[1] = 0x20|mode, stratum
+		return b
+	}
+	if err := checkNTPAnswer(answer(4, 3)); err != nil {
+		t.Errorf("got %v", err)
+	}
+	for name, tc := range map[string]struct {
+		answer []byte
+		want   string
+	}{
+		"unsynchronized": {answer(4, 16), "stratum 16"},
+		"kiss-o'-death":  {answer(4, 0), "stratum 0"},
+		"client mode":    {answer(3, 2), "no NTP answer"},
+		"short":          {answer(4, 2)[:12], "no NTP answer"},
+	} {
+		if err := checkNTPAnswer(tc.answer); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want %s", name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package command
+
+import "strings"
+
+// shellQuote quotes s for a POSIX shell, so that URLs with query
+// strings (&, ?, =) reach the remote command unchanged.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
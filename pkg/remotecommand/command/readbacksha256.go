@@ -0,0 +1,27 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// ReadBackSHA256 reads the leading bytes of the device with direct I/O,
+// bypassing the page cache, and returns their SHA-256 hash. Comparing it
+// with InstallResult.SHA256 tells whether the image made it to the disk.
+func ReadBackSHA256(m remotecommand.Machine, device string, bytes int64, cb ssh.HostKeyCallback) (string, error) {
+	const blockSize = 4 << 20
+	cmd := fmt.Sprintf(`
+    dd if=%s iflag=direct bs=%d count=%d status=none \
+    | head -c %d \
+    | sha256sum \
+    | cut -d ' ' -f 1
+  `, shellQuote(device), blockSize, (bytes+blockSize-1)/blockSize, bytes)
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return "", fmt.Errorf("Remote command ReadBackSHA256 failed: %w", err)
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}
@@ -11,25 +11,26 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// ResolveconfDNSv4 queries the global DNS servers from /etc/resolv.conf
-func ResolveconfDNSv4(m remotecommand.Machine, cb ssh.HostKeyCallback) ([]string, error) {
+// ResolveconfDNSv4 queries the global DNS servers from /etc/resolv.conf,
+// leaving out private ones (like 10.0.0.53) unless private is set.
+func ResolveconfDNSv4(m remotecommand.Machine, private bool, cb ssh.HostKeyCallback) ([]string, error) {
 	cmd := `grep nameserver /etc/resolv.conf`
 	stdout, err := remotecommand.Command(m, cmd, cb)
 	if err != nil {
 		return nil, fmt.Errorf("Remote command ResolvectlDNS failed: %w", err)
 	}
-	return parsePublicIPv4sFromResolveconf(stdout), nil
+	return parseIPv4sFromResolveconf(stdout, private), nil
 }
 
 // stdout should contain linebreak separated IPs as a byte slice
-func parsePublicIPv4sFromResolveconf(stdout []byte) []string {
+func parseIPv4sFromResolveconf(stdout []byte, private bool) []string {
 	var resolvers []string
 	scanner := bufio.NewScanner(bytes.NewReader(stdout))
 	for scanner.Scan() {
 		fields := strings.Fields(scanner.Text())
 		if len(fields) == 2 && fields[0] == "nameserver" {
 			addr, err := netip.ParseAddr(fields[1])
-			if err == nil && addr.Is4() && !addr.IsPrivate() && !addr.IsLoopback() {
+			if err == nil && addr.Is4() && (private || !addr.IsPrivate()) && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() {
 				resolvers = append(resolvers, addr.String())
 			}
 		}
@@ -9,8 +9,9 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// ResolvectlDNSv4 queries the global DNS servers from resolvectl
-func ResolvectlDNSv4(m remotecommand.Machine, cb ssh.HostKeyCallback) ([]string, error) {
+// ResolvectlDNSv4 queries the global DNS servers from resolvectl,
+// leaving out private ones (like 10.0.0.53) unless private is set.
+func ResolvectlDNSv4(m remotecommand.Machine, private bool, cb ssh.HostKeyCallback) ([]string, error) {
 	cmd := `
 	  resolvectl dns \
 		| grep ^Global: \
@@ -20,15 +21,15 @@ func ResolvectlDNSv4(m remotecommand.Machine, cb ssh.HostKeyCallback) ([]string,
 	if err != nil {
 		return nil, fmt.Errorf("Remote command ResolvectlDNS failed: %w", err)
 	}
-	return parsePublicIPv4sFromResolvectl(stdout), nil
+	return parseIPv4sFromResolvectl(stdout, private), nil
 }
 
 // stdout should contain space separated IPs as a byte slice
-func parsePublicIPv4sFromResolvectl(stdout []byte) []string {
+func parseIPv4sFromResolvectl(stdout []byte, private bool) []string {
 	var resolvers []string
 	for _, tok := range strings.Split(string(stdout), " ") {
 		addr, err := netip.ParseAddr(strings.TrimSpace(tok))
-		if err == nil && addr.Is4() && !addr.IsPrivate() && !addr.IsLoopback() {
+		if err == nil && addr.Is4() && (private || !addr.IsPrivate()) && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() {
 			resolvers = append(resolvers, addr.String())
 		}
 	}
@@ -9,8 +9,9 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// ResolvectlDNSv6 queries the global DNS servers from resolvectl
-func ResolvectlDNSv6(m remotecommand.Machine, cb ssh.HostKeyCallback) ([]string, error) {
+// ResolvectlDNSv6 queries the global DNS servers from resolvectl,
+// leaving out private ones (like fd00::53) unless private is set.
+func ResolvectlDNSv6(m remotecommand.Machine, private bool, cb ssh.HostKeyCallback) ([]string, error) {
 	cmd := `
 	  resolvectl dns \
 		| grep ^Global: \
@@ -20,15 +21,15 @@ func ResolvectlDNSv6(m remotecommand.Machine, cb ssh.HostKeyCallback) ([]string,
 	if err != nil {
 		return nil, fmt.Errorf("Remote command ResolvectlDNS failed: %w", err)
 	}
-	return parsePublicIPv6sFromResolvectl(stdout), nil
+	return parseIPv6sFromResolvectl(stdout, private), nil
 }
 
 // stdout should contain space separated IPs as a byte slice
-func parsePublicIPv6sFromResolvectl(stdout []byte) []string {
+func parseIPv6sFromResolvectl(stdout []byte, private bool) []string {
 	var resolvers []string
 	for _, tok := range strings.Split(string(stdout), " ") {
 		addr, err := netip.ParseAddr(strings.TrimSpace(tok))
-		if err == nil && addr.Is6() && !addr.IsPrivate() && !addr.IsLoopback() {
+		if err == nil && addr.Is6() && (private || !addr.IsPrivate()) && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() {
 			resolvers = append(resolvers, addr.String())
 		}
 	}
@@ -0,0 +1,138 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"github.com/fabiant7t/totalos/pkg/server"
+	"golang.org/x/crypto/ssh"
+)
+
+// SerialConsoles returns the serial ports in use as console, in order of
+// preference: the one the SPCR ACPI table of the firmware names (like
+// IPMI Serial-over-LAN), the consoles of the rescue system's kernel
+// command line and the ones the kernel enabled. A UART merely present
+// is no console.
+func SerialConsoles(m remotecommand.Machine, cb ssh.HostKeyCallback) ([]server.SerialConsole, error) {
+	cmd := `
+    echo "cmdline $(cat /proc/cmdline)"
+    [ -r /sys/firmware/acpi/tables/SPCR ] && echo "spcr $(base64 -w 0 < /sys/firmware/acpi/tables/SPCR)"
+    grep -E '^[0-9]+: uart:' /proc/tty/driver/serial 2> /dev/null | grep -v 'uart:unknown' | sed 's/^/uart /'
+    dmesg 2> /dev/null | grep -oE 'console \[tty[A-Z]+[0-9]+\] enabled' | sed 's/^/dmesg /'
+    true
+  `
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command SerialConsoles failed: %w", err)
+	}
+	return parseSerialConsoles(stdout), nil
+}
+
+var (
+	uartAddress    = regexp.MustCompile(`^(\d+): uart:\S+ (?:port:([0-9A-Fa-f]+)|mmio:0x([0-9A-Fa-f]+))`)
+	dmesgConsole   = regexp.MustCompile(`console \[(tty[A-Z]+\d+)\] enabled`)
+	serialDevice   = regexp.MustCompile(`^tty(S|AMA|USB|PS|MFD|HS)\d+$`)
+	spcrBaudRates  = map[byte]int{3: 9600, 4: 19200, 6: 57600, 7: 115200}
+	spcr8250Types  = map[byte]bool{0x00: true, 0x01: true, 0x12: true}
+	spcrPL011Types = map[byte]bool{0x03: true, 0x0e: true}
+)
+
+func parseSerialConsoles(stdout []byte) []server.SerialConsole {
+	var spcr []byte
+	var cmdline, dmesg []server.SerialConsole
+	uarts := make(map[uint64]int) // ttyS index by I/O port or MMIO address
+	s := bufio.NewScanner(bytes.NewReader(stdout))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		kind, rest, _ := strings.Cut(s.Text(), " ")
+		switch kind {
+		case "cmdline":
+			for _, arg := range strings.Fields(rest) {
+				value, ok := strings.CutPrefix(arg, "console=")
+				if !ok {
+					continue
+				}
+				device, options, _ := strings.Cut(value, ",")
+				if !serialDevice.MatchString(device) {
+					continue
+				}
+				c := server.SerialConsole{Device: device, Source: "cmdline"}
+				digits := strings.IndexFunc(options, func(r rune) bool { return r < '0' || r > '9' })
+				if digits < 0 {
+					digits = len(options)
+				}
+				c.Baud, _ = strconv.Atoi(options[:digits])
+				cmdline = append(cmdline, c)
+			}
+		case "spcr":
+			spcr, _ = base64.StdEncoding.DecodeString(strings.TrimSpace(rest))
+		case "uart":
+			if m := uartAddress.FindStringSubmatch(rest); m != nil {
+				index, _ := strconv.Atoi(m[1])
+				addr, err := strconv.ParseUint(m[2]+m[3], 16, 64)
+				if err == nil {
+					uarts[addr] = index
+				}
+			}
+		case "dmesg":
+			if m := dmesgConsole.FindStringSubmatch(rest); m != nil && serialDevice.MatchString(m[1]) {
+				dmesg = append(dmesg, server.SerialConsole{Device: m[1], Source: "dmesg"})
+			}
+		}
+	}
+
+	var consoles []server.SerialConsole
+	if c, ok := parseSPCR(spcr, uarts); ok {
+		consoles = append(consoles, c)
+	}
+	// The last console of the command line is the primary one
+	for i := len(cmdline) - 1; i >= 0; i-- {
+		consoles = append(consoles, cmdline[i])
+	}
+	consoles = append(consoles, dmesg...)
+
+	// Keep the first of every device, taking a baud rate found later on
+	var unique []server.SerialConsole
+	seen := make(map[string]int)
+	for _, c := range consoles {
+		if i, ok := seen[c.Device]; ok {
+			if unique[i].Baud == 0 {
+				unique[i].Baud = c.Baud
+			}
+			continue
+		}
+		seen[c.Device] = len(unique)
+		unique = append(unique, c)
+	}
+	return unique
+}
+
+// parseSPCR reads the Serial Port Console Redirection table: the
+// interface type at offset 36, the address of the generic address
+// structure at 44 and the baud rate code at 58.
+func parseSPCR(table []byte, uarts map[uint64]int) (server.SerialConsole, bool) {
+	if len(table) < 59 || string(table[0:4]) != "SPCR" {
+		return server.SerialConsole{}, false
+	}
+	c := server.SerialConsole{Baud: spcrBaudRates[table[58]], Source: "spcr"}
+	switch interfaceType := table[36]; {
+	case spcr8250Types[interfaceType]:
+		index, ok := uarts[binary.LittleEndian.Uint64(table[44:52])]
+		if !ok {
+			return server.SerialConsole{}, false
+		}
+		c.Device = fmt.Sprintf("ttyS%d", index)
+	case spcrPL011Types[interfaceType]:
+		c.Device = "ttyAMA0"
+	default:
+		return server.SerialConsole{}, false
+	}
+	return c, true
+}
@@ -0,0 +1,68 @@
+package command
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/server"
+)
+
+// spcrTable returns an SPCR table of the interface type, the address of
+// the UART and the baud rate code.
+func spcrTable(interfaceType byte, addr uint64, baud byte) string {
+	table := make([]byte, 80)
+	copy(table, "SPCR")
+	table[36] = interfaceType
+	binary.LittleEndian.PutUint64(table[44:52], addr)
+	table[58] = baud
+	return base64.StdEncoding.EncodeToString(table)
+}
+
+func TestParseSerialConsoles(t *testing.T) {
+	const uarts = "uart 0: uart:16550A port:000003F8 irq:4 tx:0 rx:0\n" +
+		"uart 1: uart:16550A port:000002F8 irq:3 tx:1024 rx:0 RTS|DTR\n"
+	for _, tc := range []struct {
+		name   string
+		stdout string
+		want   []server.SerialConsole
+	}{
+		{
+			"ipmi serial-over-lan named by spcr",
+			"cmdline BOOT_IMAGE=/vmlinuz console=tty0 console=ttyS1\n" +
+				"spcr " + spcrTable(0x00, 0x2f8, 7) + "\n" + uarts +
+				"dmesg console [ttyS1] enabled\n",
+			[]server.SerialConsole{{Device: "ttyS1", Baud: 115200, Source: "spcr"}},
+		},
+		{
+			"rescue console with speed",
+			"cmdline BOOT_IMAGE=/vmlinuz console=ttyS0,57600n8 console=tty0\n" + uarts,
+			[]server.SerialConsole{{Device: "ttyS0", Baud: 57600, Source: "cmdline"}},
+		},
+		{
+			"spcr baud as is, speed of the command line",
+			"cmdline console=ttyS1,38400\nspcr " + spcrTable(0x00, 0x2f8, 0) + "\n" + uarts,
+			[]server.SerialConsole{{Device: "ttyS1", Baud: 38400, Source: "spcr"}},
+		},
+		{
+			"spcr of an unknown uart, enabled by the kernel",
+			"cmdline BOOT_IMAGE=/vmlinuz\nspcr " + spcrTable(0x00, 0x3e8, 7) + "\n" + uarts + "dmesg console [ttyS0] enabled\n",
+			[]server.SerialConsole{{Device: "ttyS0", Source: "dmesg"}},
+		},
+		{
+			"arm pl011",
+			"cmdline BOOT_IMAGE=/vmlinuz\nspcr " + spcrTable(0x03, 0x9000000, 7) + "\n",
+			[]server.SerialConsole{{Device: "ttyAMA0", Baud: 115200, Source: "spcr"}},
+		},
+		{
+			"uarts present only",
+			"cmdline BOOT_IMAGE=/vmlinuz console=tty0\n" + uarts,
+			nil,
+		},
+	} {
+		if got := parseSerialConsoles([]byte(tc.stdout)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"github.com/fabiant7t/totalos/pkg/server"
+	"golang.org/x/crypto/ssh"
+)
+
+// Uplink returns the network path of the default route (IPv4, or else
+// IPv6): the interface carrying the addresses, the VLAN and bond it sits
+// on, and the physical links with their predictable names. It is nil if
+// there is no default route.
+func Uplink(m remotecommand.Machine, cb ssh.HostKeyCallback) (*server.Uplink, error) {
+	cmd := `
+    dev=$(ip -j -4 route show default | jq -r '.[0].dev // empty')
+    [ -n "$dev" ] || dev=$(ip -j -6 route show default | jq -r '.[0].dev // empty')
+    echo "route $dev"
+    echo "links $(ip -d -j link show | jq -c .)"
+    for link in /sys/class/net/*; do
+      echo "udev $(basename "$link") $(udevadm info -q property "$link" 2> /dev/null | grep '^ID_NET_NAME_' | tr '\n' ' ')"
+    done
+  `
+	stdout, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command Uplink failed: %w", err)
+	}
+	uplink, err := parseUplink(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("Remote command Uplink failed: %w", err)
+	}
+	return uplink, nil
+}
+
+// uplinkDevice is shell setting $dev to the device of the default route
+// of the address family (-4 or -6), empty if there is none.
+func uplinkDevice(family string) string {
+	return fmt.Sprintf(`dev=$(ip -j %s route show default | jq -r '.[0].dev // empty')`, family)
+}
+
+// uplinkSelect is jq (with --arg dev "$dev") selecting the interface of
+// the default route, or ethernet devices if there is none.
+const uplinkSelect = `select(if $dev == "" then (.ifname | startswith("en") or startswith("eth")) else .ifname == $dev end)`
+
+type ipLink struct {
+	IfName   string `json:"ifname"`
+	Link     string `json:"link"`
+	Master   string `json:"master"`
+	MTU      int    `json:"mtu"`
+	Address  string `json:"address"`
+	LinkInfo struct {
+		InfoKind string         `json:"info_kind"`
+		InfoData map[string]any `json:"info_data"`
+	} `json:"linkinfo"`
+}
+
+// bondOptions are the options of bonds kept, in order. The JSON of ip
+// names lacp_rate ad_lacp_rate.
+var bondOptions = []struct{ name, key string }{
+	{"xmit_hash_policy", "xmit_hash_policy"},
+	{"lacp_rate", "ad_lacp_rate"},
+	{"miimon", "miimon"},
+	{"updelay", "updelay"},
+	{"downdelay", "downdelay"},
+}
+
+func parseUplink(stdout []byte) (*server.Uplink, error) {
+	var dev string
+	var links []ipLink
+	udev := make(map[string]server.IDNetNames)
+	s := bufio.NewScanner(bytes.NewReader(stdout))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		kind, rest, _ := strings.Cut(s.Text(), " ")
+		switch kind {
+		case "route":
+			dev = strings.TrimSpace(rest)
+		case "links":
+			if err := json.Unmarshal([]byte(rest), &links); err != nil {
+				return nil, err
+			}
+		case "udev":
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				continue
+			}
+			var names server.IDNetNames
+			for _, f := range fields[1:] {
+				k, v, _ := strings.Cut(f, "=")
+				switch k {
+				case "ID_NET_NAME_FROM_DATABASE":
+					names.FromDatabase = v
+				case "ID_NET_NAME_ONBOARD":
+					names.Onboard = v
+				case "ID_NET_NAME_SLOT":
+					names.Slot = v
+				case "ID_NET_NAME_PATH":
+					names.Path = v
+				case "ID_NET_NAME_MAC":
+					names.MAC = v
+				}
+			}
+			udev[fields[0]] = names
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if dev == "" {
+		return nil, nil
+	}
+	byName := make(map[string]ipLink)
+	for _, l := range links {
+		byName[l.IfName] = l
+	}
+	cur, ok := byName[dev]
+	if !ok {
+		return nil, fmt.Errorf("default route device %s not found", dev)
+	}
+	uplink := &server.Uplink{Interface: dev, MTU: cur.MTU}
+	if cur.LinkInfo.InfoKind == "vlan" {
+		id, _ := cur.LinkInfo.InfoData["id"].(float64)
+		uplink.VLAN = &server.VLAN{ID: int(id), Parent: cur.Link}
+		if cur, ok = byName[cur.Link]; !ok {
+			return nil, fmt.Errorf("parent %s of VLAN %s not found", uplink.VLAN.Parent, dev)
+		}
+	}
+	physical := []ipLink{cur}
+	if cur.LinkInfo.InfoKind == "bond" {
+		mode, _ := cur.LinkInfo.InfoData["mode"].(string)
+		bond := &server.Bond{Name: cur.IfName, Mode: mode}
+		for _, o := range bondOptions {
+			switch v := cur.LinkInfo.InfoData[o.key].(type) {
+			case string:
+				if v != "" && (o.name != "lacp_rate" || mode == "802.3ad") {
+					bond.Options = append(bond.Options, o.name+"="+v)
+				}
+			case float64:
+				if v > 0 {
+					bond.Options = append(bond.Options, fmt.Sprintf("%s=%d", o.name, int(v)))
+				}
+			}
+		}
+		uplink.Bond = bond
+		physical = nil
+		for _, l := range links {
+			if l.Master == cur.IfName {
+				physical = append(physical, l)
+			}
+		}
+		if len(physical) == 0 {
+			return nil, fmt.Errorf("bond %s has no slaves", cur.IfName)
+		}
+	}
+	for _, l := range physical {
+		uplink.Links = append(uplink.Links, server.Link{Name: l.IfName, MAC: l.Address, IDNetNames: udev[l.IfName]})
+	}
+	return uplink, nil
+}
@@ -0,0 +1,53 @@
+package command
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fabiant7t/totalos/pkg/server"
+)
+
+const uplinkLinks = `[` +
+	`{"ifindex":1,"ifname":"lo","mtu":65536,"address":"00:00:00:00:00:00"},` +
+	`{"ifindex":2,"ifname":"eth0","mtu":1500,"master":"bond0","address":"0c:c4:7a:00:00:01","linkinfo":{"info_slave_kind":"bond"}},` +
+	`{"ifindex":3,"ifname":"eth1","mtu":1500,"master":"bond0","address":"0c:c4:7a:00:00:01","linkinfo":{"info_slave_kind":"bond"}},` +
+	`{"ifindex":4,"ifname":"eth2","mtu":1500,"address":"0c:c4:7a:00:00:03"},` +
+	`{"ifindex":5,"ifname":"bond0","mtu":1500,"address":"0c:c4:7a:00:00:01","linkinfo":{"info_kind":"bond","info_data":{"mode":"802.3ad","miimon":100,"updelay":0,"downdelay":0,"xmit_hash_policy":"layer3+4","ad_lacp_rate":"fast"}}},` +
+	`{"ifindex":6,"ifname":"bond0.4000","link":"bond0","mtu":1400,"address":"0c:c4:7a:00:00:01","linkinfo":{"info_kind":"vlan","info_data":{"protocol":"802.1Q","id":4000}}},` +
+	`{"ifindex":7,"ifname":"eth2.4001","link":"eth2","mtu":1400,"address":"0c:c4:7a:00:00:03","linkinfo":{"info_kind":"vlan","info_data":{"protocol":"802.1Q","id":4001}}}` +
+	`]`
+
+const uplinkUdev = "udev eth0 ID_NET_NAME_MAC=enx0cc47a000001 ID_NET_NAME_PATH=enp1s0f0 \n" +
+	"udev eth1 ID_NET_NAME_PATH=enp1s0f1 \n" +
+	"udev eth2 ID_NET_NAME_ONBOARD=eno1 ID_NET_NAME_PATH=enp2s0 \n" +
+	"udev lo \n"
+
+func TestParseUplink(t *testing.T) {
+	eth0 := server.Link{Name: "eth0", MAC: "0c:c4:7a:00:00:01", IDNetNames: server.IDNetNames{Path: "enp1s0f0", MAC: "enx0cc47a000001"}}
+	eth1 := server.Link{Name: "eth1", MAC: "0c:c4:7a:00:00:01", IDNetNames: server.IDNetNames{Path: "enp1s0f1"}}
+	eth2 := server.Link{Name: "eth2", MAC: "0c:c4:7a:00:00:03", IDNetNames: server.IDNetNames{Onboard: "eno1", Path: "enp2s0"}}
+	bond := &server.Bond{Name: "bond0", Mode: "802.3ad", Options: []string{"xmit_hash_policy=layer3+4", "lacp_rate=fast", "miimon=100"}}
+	for _, tc := range []struct {
+		route string
+		want  *server.Uplink
+	}{
+		{"eth2", &server.Uplink{Interface: "eth2", MTU: 1500, Links: []server.Link{eth2}}},
+		{"bond0", &server.Uplink{Interface: "bond0", MTU: 1500, Bond: bond, Links: []server.Link{eth0, eth1}}},
+		{"bond0.4000", &server.Uplink{Interface: "bond0.4000", MTU: 1400, VLAN: &server.VLAN{ID: 4000, Parent: "bond0"}, Bond: bond, Links: []server.Link{eth0, eth1}}},
+		{"eth2.4001", &server.Uplink{Interface: "eth2.4001", MTU: 1400, VLAN: &server.VLAN{ID: 4001, Parent: "eth2"}, Links: []server.Link{eth2}}},
+		{"", nil},
+	} {
+		got, err := parseUplink([]byte("route " + tc.route + "\nlinks " + uplinkLinks + "\n" + uplinkUdev))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.route, err)
+		}
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(tc.want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: got %s, want %s", tc.route, gotJSON, wantJSON)
+		}
+	}
+	if _, err := parseUplink([]byte("route eth9\nlinks " + uplinkLinks + "\n")); err == nil {
+		t.Error("got no error for an unknown device")
+	}
+}
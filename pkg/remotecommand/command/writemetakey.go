@@ -0,0 +1,45 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/fabiant7t/totalos/pkg/meta"
+	"github.com/fabiant7t/totalos/pkg/remotecommand"
+	"golang.org/x/crypto/ssh"
+)
+
+// WriteMetaKey sets the value of the key in the META partition of the
+// Talos image on the device, keeping the values of other keys. Writing
+// the same value again changes nothing.
+func WriteMetaKey(m remotecommand.Machine, device string, key uint8, value []byte, cb ssh.HostKeyCallback) error {
+	parts, err := SystemPartitions(m, device, cb)
+	if err != nil {
+		return err
+	}
+	if parts.Meta == "" {
+		return fmt.Errorf("Remote command WriteMetaKey failed: %w", parts.missing("META"))
+	}
+	cmd := fmt.Sprintf(`head -c %d %s`, 2*meta.Length, shellQuote(parts.Meta))
+	current, err := remotecommand.Command(m, cmd, cb)
+	if err != nil {
+		return fmt.Errorf("Remote command WriteMetaKey failed: %w", err)
+	}
+	values, err := meta.Unmarshal(current)
+	if err != nil {
+		return fmt.Errorf("Remote command WriteMetaKey failed: %w", err)
+	}
+	values[key] = value
+	b, err := values.Marshal()
+	if err != nil {
+		return fmt.Errorf("Remote command WriteMetaKey failed: %w", err)
+	}
+	if bytes.Equal(b, current) {
+		return nil
+	}
+	cmd = fmt.Sprintf(`dd of=%s bs=64K conv=notrunc,fsync status=none`, shellQuote(parts.Meta))
+	if err := remotecommand.Run(m, cmd, bytes.NewReader(b), &bytes.Buffer{}, cb); err != nil {
+		return fmt.Errorf("Remote command WriteMetaKey failed: %w", err)
+	}
+	return nil
+}
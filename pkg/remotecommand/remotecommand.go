@@ -1,7 +1,10 @@
 package remotecommand
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -17,10 +20,19 @@ type Machine interface {
 	User() string
 }
 
+// Command runs the command on the machine and returns its stdout.
 func Command(m Machine, cmd string, hostKeyCallback ssh.HostKeyCallback) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := Run(m, cmd, nil, &stdout, hostKeyCallback)
+	return stdout.Bytes(), err
+}
+
+// Run runs the command on the machine, feeds it stdin (if not nil) and
+// streams its stdout to the writer while the command is running.
+func Run(m Machine, cmd string, stdin io.Reader, stdout io.Writer, hostKeyCallback ssh.HostKeyCallback) error {
 	// Refuse executing empty commands
 	if cmd == "" {
-		return nil, ErrEmptyCommand
+		return ErrEmptyCommand
 	}
 	// hostKeyCallback nil means the host key is not being verified
 	if hostKeyCallback == nil {
@@ -35,7 +47,7 @@ func Command(m Machine, cmd string, hostKeyCallback ssh.HostKeyCallback) ([]byte
 	if key := m.Key(); len(key) != 0 {
 		signer, err := ssh.ParsePrivateKey(m.Key())
 		if err != nil {
-			return nil, err
+			return err
 		}
 		authMethods = append(authMethods, ssh.PublicKeys(signer))
 	}
@@ -47,13 +59,28 @@ func Command(m Machine, cmd string, hostKeyCallback ssh.HostKeyCallback) ([]byte
 	}
 	c, err := ssh.Dial("tcp", m.Addr(), cc)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer c.Close()
 	sess, err := c.NewSession()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer sess.Close()
-	// run the command and return stdout
-	return sess.Output(cmd)
+	// run the command, the tail of stderr tells what failed
+	var stderr bytes.Buffer
+	sess.Stdin = stdin
+	sess.Stdout = stdout
+	sess.Stderr = &stderr
+	if err := sess.Run(cmd); err != nil {
+		msg := bytes.TrimSpace(stderr.Bytes())
+		if len(msg) > 1024 {
+			msg = msg[len(msg)-1024:]
+		}
+		if len(msg) > 0 {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
 }
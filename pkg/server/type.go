@@ -75,6 +75,96 @@ func (idnn *IDNetNames) InterfaceName() string {
 	return ""
 }
 
+// Uplink is the network path of the default route of the rescue system:
+// a plain interface, a bond, a VLAN sub-interface or a VLAN on a bond.
+type Uplink struct {
+	// Interface carries the addresses, like eth0, bond0 or eth0.4000.
+	Interface string `json:"interface"`
+	MTU       int    `json:"mtu"`
+	// VLAN of the interface, if it is a VLAN sub-interface.
+	VLAN *VLAN `json:"vlan,omitempty"`
+	// Bond the interface is, or its VLAN sits on.
+	Bond *Bond `json:"bond,omitempty"`
+	// Links are the physical interfaces, the slaves of the bond or the one
+	// interface.
+	Links []Link `json:"links"`
+}
+
+// VLAN is a tagged (802.1Q) sub-interface of its parent.
+type VLAN struct {
+	ID     int    `json:"id"`
+	Parent string `json:"parent"`
+}
+
+// Bond aggregates its slaves (the links of the uplink).
+type Bond struct {
+	Name string `json:"name"`
+	// Mode like 802.3ad (LACP) or active-backup.
+	Mode string `json:"mode"`
+	// Options other than the mode, like xmit_hash_policy=layer3+4.
+	Options []string `json:"options,omitempty"`
+}
+
+// Link is a physical interface, named by the rescue system.
+type Link struct {
+	Name       string     `json:"name"`
+	MAC        string     `json:"mac"`
+	IDNetNames IDNetNames `json:"id_net_names"`
+}
+
+// TalosName returns the name Talos gives the link, which is the name
+// in the rescue system if predictable naming yields none.
+func (l *Link) TalosName() string {
+	if name := l.IDNetNames.InterfaceName(); name != "" {
+		return name
+	}
+	return l.Name
+}
+
+// TalosInterface returns the name of the interface carrying the addresses
+// under Talos: the physical link by its Talos name, the bond by its name,
+// and VLANs as <parent>.<id> of the Talos name of the parent.
+func (u *Uplink) TalosInterface() string {
+	name := u.Interface
+	if u.VLAN != nil {
+		name = u.VLAN.Parent
+	}
+	if u.Bond == nil {
+		for _, l := range u.Links {
+			if l.Name == name {
+				name = l.TalosName()
+			}
+		}
+	}
+	if u.VLAN != nil {
+		return fmt.Sprintf("%s.%d", name, u.VLAN.ID)
+	}
+	return name
+}
+
+// SerialConsole is a serial port in use as console, like the one of
+// IPMI Serial-over-LAN.
+type SerialConsole struct {
+	// Device like ttyS1 or ttyAMA0.
+	Device string `json:"device"`
+	// Baud rate, 0 if unknown.
+	Baud int `json:"baud"`
+	// Source tells how it was found: spcr (the ACPI table of the firmware
+	// naming the console), cmdline (a console of the rescue system) or
+	// dmesg (a console the kernel enabled).
+	Source string `json:"source"`
+}
+
+// Option returns the console= value of the port, like ttyS1,115200n8. The
+// baud rate defaults to 115200.
+func (c *SerialConsole) Option() string {
+	baud := c.Baud
+	if baud == 0 {
+		baud = 115200
+	}
+	return fmt.Sprintf("%s,%dn8", c.Device, baud)
+}
+
 type Memory struct {
 	Size    GigaByte `json:"size_gb"`
 	Modules []string `json:"modules"`
@@ -90,13 +180,56 @@ type System struct {
 	SKUNumber    string `json:"sku_number"`
 }
 
+// DeviceTree describes boards booting with a device tree, like arm64
+// single-board computers.
+type DeviceTree struct {
+	Model      string   `json:"model"`
+	Compatible []string `json:"compatible"`
+}
+
+// PCIDevice is a network controller, storage controller (HBA), display
+// controller (GPU) or accelerator of the machine. IDs are hexadecimal
+// without prefix, like lspci -n shows them.
+type PCIDevice struct {
+	Slot   string `json:"slot"`
+	Vendor string `json:"vendor"`
+	Device string `json:"device"`
+	Class  string `json:"class"`
+	// Driver bound by the rescue system, empty if none.
+	Driver string `json:"driver"`
+}
+
+// Firmware describes how the machine boots: UEFI or legacy BIOS, and the
+// Secure Boot state of UEFI firmware.
+type Firmware struct {
+	// Mode is uefi or bios.
+	Mode       string `json:"mode"`
+	SecureBoot bool   `json:"secure_boot"`
+	// SetupMode tells that no platform key is enrolled, so that keys can
+	// be enrolled (like Talos secureboot images do on first boot) and
+	// signatures are not enforced.
+	SetupMode bool `json:"setup_mode"`
+}
+
+// SecureBootEnforced tells whether the firmware boots signed images only.
+func (f *Firmware) SecureBootEnforced() bool {
+	return f.Mode == "uefi" && f.SecureBoot && !f.SetupMode
+}
+
 type Machine struct {
-	Arch        string   `json:"arch"`
-	IPv4Network Network  `json:"ipv4_network"`
-	Hostname    string   `json:"hostname"`
-	Disks       []Disk   `json:"disks"`
-	CPU         CPU      `json:"cpu"`
-	Memory      Memory   `json:"memory"`
-	System      System   `json:"system"`
-	Ethernet    Ethernet `json:"ethernet"`
+	Arch        string      `json:"arch"`
+	IPv4Network Network     `json:"ipv4_network"`
+	IPv6Network Network     `json:"ipv6_network"`
+	Hostname    string      `json:"hostname"`
+	Disks       []Disk      `json:"disks"`
+	CPU         CPU         `json:"cpu"`
+	Memory      Memory      `json:"memory"`
+	System      System      `json:"system"`
+	Ethernet    Ethernet    `json:"ethernet"`
+	DeviceTree  DeviceTree  `json:"device_tree"`
+	Firmware    Firmware    `json:"firmware"`
+	PCIDevices  []PCIDevice `json:"pci_devices"`
+	Uplink      *Uplink     `json:"uplink,omitempty"`
+	// SerialConsoles in order of preference.
+	SerialConsoles []SerialConsole `json:"serial_consoles"`
 }
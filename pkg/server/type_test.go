@@ -24,3 +24,53 @@ func TestInterfaceName(t *testing.T) {
 		}
 	}
 }
+
+func TestSecureBootEnforced(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fw   *server.Firmware
+		want bool
+	}{
+		{"legacy bios", &server.Firmware{Mode: "bios"}, false},
+		{"uefi without secure boot", &server.Firmware{Mode: "uefi"}, false},
+		{"uefi with secure boot", &server.Firmware{Mode: "uefi", SecureBoot: true}, true},
+		{"uefi in setup mode", &server.Firmware{Mode: "uefi", SecureBoot: true, SetupMode: true}, false},
+	} {
+		if got := tc.fw.SecureBootEnforced(); got != tc.want {
+			t.Errorf("%s: got %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUplinkTalosInterface(t *testing.T) {
+	eth0 := server.Link{Name: "eth0", IDNetNames: server.IDNetNames{Path: "enp1s0f0"}}
+	eth1 := server.Link{Name: "eth1", IDNetNames: server.IDNetNames{Path: "enp1s0f1"}}
+	for _, tc := range []struct {
+		name   string
+		uplink *server.Uplink
+		want   string
+	}{
+		{"plain", &server.Uplink{Interface: "eth0", Links: []server.Link{eth0}}, "enp1s0f0"},
+		{"plain without predictable name", &server.Uplink{Interface: "eth0", Links: []server.Link{{Name: "eth0"}}}, "eth0"},
+		{"vlan", &server.Uplink{Interface: "eth0.4000", VLAN: &server.VLAN{ID: 4000, Parent: "eth0"}, Links: []server.Link{eth0}}, "enp1s0f0.4000"},
+		{"bond", &server.Uplink{Interface: "bond0", Bond: &server.Bond{Name: "bond0"}, Links: []server.Link{eth0, eth1}}, "bond0"},
+		{
+			"vlan on bond",
+			&server.Uplink{Interface: "vlan4000", VLAN: &server.VLAN{ID: 4000, Parent: "bond0"}, Bond: &server.Bond{Name: "bond0"}, Links: []server.Link{eth0, eth1}},
+			"bond0.4000",
+		},
+	} {
+		if got := tc.uplink.TalosInterface(); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSerialConsoleOption(t *testing.T) {
+	if got, want := (&server.SerialConsole{Device: "ttyS1", Baud: 57600}).Option(), "ttyS1,57600n8"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := (&server.SerialConsole{Device: "ttyS0"}).Option(), "ttyS0,115200n8"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}